@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -23,38 +25,108 @@ func attackCmd() command {
 	}
 
 	fs.StringVar(&opts.targetsf, "targets", "stdin", "Targets file")
-	fs.StringVar(&opts.outputf, "output", "result.json", "Output file")
+	fs.StringVar(&opts.format, "format", stress.FormatAuto, "Targets format [auto, text, jsonl]")
+	fs.StringVar(&opts.outputf, "output", "result.json", "Output file, stdout streaming results as JSON lines")
+	fs.BoolVar(&opts.summary, "summary", true, "Print the text report of the attack, to stderr when the output is stdout")
 	fs.StringVar(&opts.bodyf, "body", "", "Requests body file")
+	fs.Int64Var(&opts.bodyCache, "body-cache", stress.DefaultBodyCache>>20, "Memory budget of preloaded request bodies in MB")
+	fs.BoolVar(&opts.templateFiles, "template-files", false, "Render body files as templates for every request")
+	fs.StringVar(&opts.feederf, "feeder", "", "Data feeder file [.csv, .jsonl]")
+	fs.StringVar(&opts.feederMode, "feeder-mode", stress.FeedSequential, "Data feeder mode [sequential, random, unique]")
+	fs.BoolVar(&opts.feederRecycle, "feeder-recycle", true, "Start over when the data feeder runs out of rows instead of stopping, unique feeders stopping unless set")
 	fs.StringVar(&opts.ordering, "ordering", "random", "Attack ordering [sequential, random]")
 	fs.DurationVar(&opts.duration, "duration", 10*time.Second, "Duration of the test")
-	fs.DurationVar(&opts.timeout, "timeout", 0, "Requests timeout")
+	fs.DurationVar(&opts.timeout, "timeout", stress.DefaultTimeouts.Total, "Requests timeout")
+	fs.DurationVar(&opts.connectTimeout, "connect-timeout", stress.DefaultTimeouts.Connect, "Connection timeout")
+	fs.DurationVar(&opts.tlsTimeout, "tls-timeout", stress.DefaultTimeouts.TLS, "TLS handshake timeout")
+	fs.DurationVar(&opts.headerTimeout, "header-timeout", stress.DefaultTimeouts.Header, "Response headers timeout")
+	fs.DurationVar(&opts.bodyTimeout, "body-timeout", stress.DefaultTimeouts.Body, "Response body timeout")
 	fs.Uint64Var(&opts.rate, "rate", 0, "Requests per second")
 	fs.Uint64Var(&opts.concurrency, "c", 0, "Concurrency level")
 	fs.Uint64Var(&opts.number, "n", 1000, "Requests number")
 	fs.IntVar(&opts.redirects, "redirects", 10, "Number of redirects to follow")
+	fs.IntVar(&opts.chunkSize, "chunk-size", 0, "Size of the chunks request bodies are written in")
+	fs.BoolVar(&opts.cookies, "cookies", false, "Keep a cookie jar per worker or virtual user")
+	fs.Uint64Var(&opts.users, "users", stress.DefaultUsers, "Number of virtual users in rate mode")
 	fs.Var(&opts.headers, "header", "Request header")
+	fs.StringVar(&opts.auth, "auth", "", "Authentication [basic:user:password, bearer:token, oauth2]")
+	fs.StringVar(&opts.oauth2URL, "oauth2-url", "", "OAuth2 token endpoint URL")
+	fs.StringVar(&opts.oauth2ID, "oauth2-client-id", "", "OAuth2 client id")
+	fs.StringVar(&opts.oauth2Secret, "oauth2-client-secret", "", "OAuth2 client secret, defaulting to $STRESS_OAUTH2_CLIENT_SECRET")
+	fs.StringVar(&opts.oauth2Scopes, "oauth2-scopes", "", "OAuth2 scopes (comma separated)")
+	fs.StringVar(&opts.sign, "sign", "", "Request signing [hmac, sigv4]")
+	fs.StringVar(&opts.signKey, "sign-key", "", "Signing key id or access key")
+	fs.StringVar(&opts.signSecret, "sign-secret", "", "Signing secret, defaulting to $STRESS_SIGN_SECRET")
+	fs.StringVar(&opts.signHeader, "sign-header", "Authorization", "Header of the hmac signature")
+	fs.StringVar(&opts.signRegion, "sign-region", "us-east-1", "Region of the sigv4 signature")
+	fs.StringVar(&opts.signService, "sign-service", "s3", "Service of the sigv4 signature")
+	fs.StringVar(&opts.acceptEncoding, "accept-encoding", "gzip", "Accept-Encoding header of the requests, empty for none")
+	fs.StringVar(&opts.compress, "compress", "", "Compress request bodies [gzip, deflate, zstd]")
+	fs.StringVar(&opts.network, "network", "", "Emulated network [slow-3g, 3g, 4g][;down=size][;up=size][;latency=d][;jitter=d]")
+	fs.StringVar(&opts.stopOn, "stop-on", "", "Stop the attack early on [errors=n][;ratio=r][;p99=d][;window=d][;min=n]")
+	fs.DurationVar(&opts.progress, "progress", 5*time.Second, "Interval of the progress printed to stderr, 0 for none")
+	fs.StringVar(&opts.http, "http", "", "Address to serve a live web dashboard on while attacking, e.g. :8089")
+	fs.BoolVar(&opts.tui, "tui", false, "Show a live dashboard while attacking, when stdout is a terminal")
+	fs.StringVar(&opts.proxy, "proxy", "", "Proxy URL [http://, socks5://, direct], defaulting to $HTTP_PROXY")
 	fs.Var(&opts.laddr, "laddr", "Local IP address")
 
 	return command{fs, func(args []string) error {
 		fs.Parse(args)
+		// Unique rows are used once per run unless told otherwise
+		if opts.feederMode == stress.FeedUnique && !isSet(fs, "feeder-recycle") {
+			opts.feederRecycle = false
+		}
 		return attack(opts)
 	}}
 }
 
 // attackOpts aggregates the attack function command options
 type attackOpts struct {
-	targetsf    string
-	outputf     string
-	bodyf       string
-	ordering    string
-	timeout     time.Duration
-	rate        uint64
-	duration    time.Duration
-	concurrency uint64
-	number      uint64
-	redirects   int
-	headers     headers
-	laddr       localAddr
+	targetsf       string
+	format         string
+	outputf        string
+	summary        bool
+	bodyf          string
+	bodyCache      int64
+	templateFiles  bool
+	feederf        string
+	feederMode     string
+	feederRecycle  bool
+	ordering       string
+	timeout        time.Duration
+	connectTimeout time.Duration
+	tlsTimeout     time.Duration
+	headerTimeout  time.Duration
+	bodyTimeout    time.Duration
+	rate           uint64
+	duration       time.Duration
+	concurrency    uint64
+	number         uint64
+	redirects      int
+	chunkSize      int
+	cookies        bool
+	users          uint64
+	headers        headers
+	auth           string
+	oauth2URL      string
+	oauth2ID       string
+	oauth2Secret   string
+	oauth2Scopes   string
+	sign           string
+	signKey        string
+	signSecret     string
+	signHeader     string
+	signRegion     string
+	signService    string
+	proxy          string
+	acceptEncoding string
+	compress       string
+	network        string
+	stopOn         string
+	progress       time.Duration
+	tui            bool
+	http           string
+	laddr          localAddr
 }
 
 // attack validates the attack arguments, sets up the
@@ -93,12 +165,31 @@ func attack(opts *attackOpts) error {
 		}
 	}
 
-	targets, err := stress.NewTargetsFrom(in, body, opts.headers.Header)
+	targets, err := stress.ReadTargets(in, opts.format, body, opts.headers.Header)
 	if err != nil {
 		return fmt.Errorf(errTargetsFilePrefix+"(%s): %s", opts.targetsf, err)
 	}
 	if len(targets) == 0 {
-		return fmt.Errorf(errTargetsFilePrefix+" : is empty")
+		return fmt.Errorf(errTargetsFilePrefix + " : is empty")
+	}
+	if opts.templateFiles {
+		targets.TemplateFiles()
+	}
+	if err = targets.Preload(opts.bodyCache << 20); err != nil {
+		return err
+	}
+	if opts.compress != "" {
+		if err = targets.Compress(opts.compress); err != nil {
+			return fmt.Errorf(errCompressPrefix+"%s", err)
+		}
+	}
+
+	if opts.feederf != "" {
+		feeder, err := newFeeder(opts)
+		if err != nil {
+			return fmt.Errorf(errFeederFilePrefix+"(%s): %s", opts.feederf, err)
+		}
+		targets.Feed(feeder)
 	}
 
 	switch opts.ordering {
@@ -110,6 +201,23 @@ func attack(opts *attackOpts) error {
 		return fmt.Errorf(errOrderingPrefix+"`%s` is invalid", opts.ordering)
 	}
 
+	// Both would set the authorization of the requests
+	if opts.sign != "" && opts.auth != "" {
+		return fmt.Errorf(errSignPrefix + "can't be combined with -auth")
+	}
+	signer, err := newSigner(opts)
+	if err != nil {
+		return fmt.Errorf(errSignPrefix+"%s", err)
+	}
+	if signer != nil {
+		targets.Sign(signer)
+	}
+
+	auth, err := newAuth(opts)
+	if err != nil {
+		return fmt.Errorf(errAuthPrefix+"%s", err)
+	}
+
 	out, err := file(opts.outputf, true)
 	if err != nil {
 		return fmt.Errorf(errOutputFilePrefix+"(%s): %s", opts.outputf, err)
@@ -117,6 +225,69 @@ func attack(opts *attackOpts) error {
 	defer out.Close()
 
 	attacker := stress.NewAttacker(opts.redirects, opts.timeout, *opts.laddr.IPAddr)
+	attacker.SetCookies(opts.cookies)
+	attacker.SetUsers(opts.users)
+	attacker.SetChunkSize(opts.chunkSize)
+	attacker.SetAuth(auth)
+	attacker.SetAcceptEncoding(opts.acceptEncoding)
+	// Results written to stdout are streamed, leaving it to them alone so
+	// that they can be piped to stress report
+	summary := io.Writer(os.Stdout)
+	if out == os.Stdout {
+		attacker.SetStream(out)
+		summary = os.Stderr
+	}
+	if opts.stopOn != "" {
+		breaker, err := stress.ParseBreaker(opts.stopOn)
+		if err != nil {
+			return fmt.Errorf(errStopOnPrefix+"%s", err)
+		}
+		attacker.SetBreaker(breaker)
+	}
+	if opts.network != "" {
+		network, err := stress.ParseNetwork(opts.network)
+		if err != nil {
+			return fmt.Errorf(errNetworkPrefix+"%s", err)
+		}
+		attacker.SetNetwork(network)
+	}
+	if opts.proxy != "" {
+		proxy, err := stress.ParseProxy(opts.proxy)
+		if err != nil {
+			return fmt.Errorf(errProxyPrefix+"%s", err)
+		}
+		attacker.SetProxy(http.ProxyURL(proxy))
+	}
+	// The dashboard falls back to the progress logs out of terminals
+	var dash *dashboard
+	if opts.tui && out != os.Stdout && isTerminal(os.Stdout) {
+		if dash, err = newDashboard(attacker, targets, opts.rate, os.Stdout); err != nil {
+			log.Printf("Dashboard unavailable, logging progress instead: %s\n", err)
+		}
+	}
+	if dash != nil {
+		attacker.SetProgress(dashboardInterval, dash.update)
+	} else if opts.progress > 0 {
+		attacker.SetProgress(opts.progress, logProgress)
+	}
+	if opts.http != "" {
+		ln, err := net.Listen("tcp", opts.http)
+		if err != nil {
+			return fmt.Errorf(errHTTPPrefix+"%s", err)
+		}
+		defer ln.Close()
+		web := stress.NewWebDashboard()
+		go http.Serve(ln, web)
+		attacker.AddProgress(dashboardInterval, web.Update)
+		log.Printf("Serving the live dashboard on http://%s/\n", ln.Addr())
+	}
+	attacker.SetTimeouts(stress.Timeouts{
+		Connect: opts.connectTimeout,
+		TLS:     opts.tlsTimeout,
+		Header:  opts.headerTimeout,
+		Body:    opts.bodyTimeout,
+		Total:   opts.timeout,
+	})
 
 	var results stress.Results
 	if opts.rate != 0 {
@@ -142,21 +313,42 @@ func attack(opts *attackOpts) error {
 		)
 		results = attacker.AttackConcy(targets, opts.concurrency, opts.number)
 	}
+	if dash != nil {
+		dash.close()
+	}
 
-	log.Printf("Done! Writing results to '%s'...", opts.outputf)
-	err = results.Encode(out)
-	if err != nil {
-		return err
+	if oauth2, ok := auth.(*stress.OAuth2); ok {
+		stats := oauth2.Stats()
+		log.Printf("OAuth2 tokens: %d fetches, %d failures, %s mean, %s max latency\n",
+			stats.Fetches, stats.Failures, stats.Mean(), stats.Max)
+		if stats.LastError != "" {
+			log.Printf("OAuth2 last error: %s\n", stats.LastError)
+		}
 	}
 
-	data, err := stress.ReportText(results)
-	if err != nil {
-		return err
+	if out != os.Stdout {
+		log.Printf("Done! Writing results to '%s'...", opts.outputf)
+		if err = results.Encode(out); err != nil {
+			return err
+		}
 	}
 
-	_, err = os.Stdout.Write(data)
+	if opts.summary {
+		data, err := stress.ReportText(results)
+		if err != nil {
+			return err
+		}
+		if _, err = summary.Write(data); err != nil {
+			return err
+		}
+	}
 
-	return err
+	for _, res := range results {
+		if res.Stopped != "" {
+			return &exitError{exitStopped, "Attack stopped early: " + res.Stopped}
+		}
+	}
+	return nil
 }
 
 const (
@@ -167,10 +359,112 @@ const (
 	errOutputFilePrefix  = "Output file: "
 	errTargetsFilePrefix = "Targets file: "
 	errBodyFilePrefix    = "Body file: "
+	errFeederFilePrefix  = "Feeder file: "
+	errAuthPrefix        = "Auth: "
+	errSignPrefix        = "Sign: "
+	errProxyPrefix       = "Proxy: "
+	errHTTPPrefix        = "HTTP: "
+	errCompressPrefix    = "Compress: "
 	errOrderingPrefix    = "Ordering: "
 	errReportingPrefix   = "Reporting: "
+	errStopOnPrefix      = "Stop on: "
+	errNetworkPrefix     = "Network: "
 )
 
+// isSet reports whether the flag name was set on the command line
+func isSet(fs *flag.FlagSet, name string) (set bool) {
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// newFeeder reads the data feeder file in the format told by its extension
+func newFeeder(opts *attackOpts) (*stress.Feeder, error) {
+	in, err := file(opts.feederf, false)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	switch strings.ToLower(filepath.Ext(opts.feederf)) {
+	case ".csv":
+		return stress.NewCSVFeeder(in, opts.feederMode, opts.feederRecycle)
+	case ".json", ".jsonl", ".ndjson":
+		return stress.NewJSONFeeder(in, opts.feederMode, opts.feederRecycle)
+	default:
+		return nil, fmt.Errorf("unknown format, use .csv or .jsonl")
+	}
+}
+
+// newAuth returns the Authenticator of the attack, if any
+func newAuth(opts *attackOpts) (stress.Authenticator, error) {
+	kv := strings.SplitN(opts.auth, ":", 2)
+	switch {
+	case opts.auth == "":
+		return nil, nil
+	case kv[0] == "basic" && len(kv) == 2 && strings.Contains(kv[1], ":"):
+		creds := strings.SplitN(kv[1], ":", 2)
+		return stress.BasicAuth{Username: creds[0], Password: creds[1]}, nil
+	case kv[0] == "bearer" && len(kv) == 2 && kv[1] != "":
+		return stress.BearerToken(kv[1]), nil
+	case opts.auth == "oauth2":
+		if opts.oauth2URL == "" || opts.oauth2ID == "" {
+			return nil, fmt.Errorf("oauth2 needs -oauth2-url and -oauth2-client-id")
+		}
+		secret := opts.oauth2Secret
+		if secret == "" {
+			secret = os.Getenv("STRESS_OAUTH2_CLIENT_SECRET")
+		}
+		var scopes []string
+		if opts.oauth2Scopes != "" {
+			scopes = strings.Split(opts.oauth2Scopes, ",")
+		}
+		return stress.NewOAuth2(opts.oauth2URL, opts.oauth2ID, secret, scopes), nil
+	}
+	return nil, fmt.Errorf("`%s` is invalid", opts.auth)
+}
+
+// newSigner returns the Signer of the attack requests, if any
+func newSigner(opts *attackOpts) (stress.Signer, error) {
+	secret := opts.signSecret
+	if secret == "" {
+		secret = os.Getenv("STRESS_SIGN_SECRET")
+	}
+	if opts.sign != "" && (opts.signKey == "" || secret == "") {
+		return nil, fmt.Errorf("%s needs -sign-key and -sign-secret", opts.sign)
+	}
+	switch opts.sign {
+	case "":
+		return nil, nil
+	case "hmac":
+		return &stress.HMACSigner{KeyID: opts.signKey, Secret: secret, Header: opts.signHeader}, nil
+	case "sigv4":
+		return &stress.SigV4Signer{
+			AccessKey:    opts.signKey,
+			SecretKey:    secret,
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+			Region:       opts.signRegion,
+			Service:      opts.signService,
+		}, nil
+	}
+	return nil, fmt.Errorf("`%s` is invalid", opts.sign)
+}
+
+// logProgress logs the progress of a running attack, leaving the last one
+// up to the summary
+func logProgress(p stress.Progress) {
+	if p.Done {
+		return
+	}
+	interval := fmt.Sprintf("last %s: no results", p.Interval.Round(time.Millisecond))
+	if p.Success > 0 || p.Errors > 0 {
+		interval = fmt.Sprintf("last %s: %.2f%% success, %s p50, %s p99, %d errors",
+			p.Interval.Round(time.Millisecond), p.Success*100, p.P50, p.P99, p.Errors)
+	}
+	log.Printf("%s elapsed, %s remaining, %d/%d requests, %.2f/s, %d in flight | %s\n",
+		p.Elapsed.Round(time.Second), p.Remaining.Round(time.Second),
+		p.Requests, p.Total, p.Rate, p.InFlight, interval)
+}
+
 // headers is the http.Header used in each target request
 // it is defined here to implement the flag.Value interface
 // in order to support multiple identical flags for request header
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	stress "github.com/buaazp/stress/lib"
+)
+
+const (
+	// dashboardInterval is how often the dashboards are updated
+	dashboardInterval = time.Second
+	// dashboardHistory bounds the intervals the sparklines are drawn of
+	dashboardHistory = 512
+)
+
+// dashboard is the full screen terminal dashboard of a running attack,
+// which the keyboard of the terminal pauses, resumes, paces and stops
+type dashboard struct {
+	attacker *stress.Attacker
+	targets  stress.Targets
+	tty      *os.File
+	out      io.Writer
+	stty     string
+	sigc     chan os.Signal
+
+	mu         sync.Mutex
+	rate       uint64
+	last       *stress.Progress
+	results    uint64
+	throughput []float64
+	latencies  []float64
+	logs       []string
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// newDashboard takes over the terminal to draw the dashboard of the attack
+// of targets by attacker at rate, zero in concurrency mode, on out. Logs
+// are shown in the dashboard until it is closed.
+func newDashboard(attacker *stress.Attacker, targets stress.Targets, rate uint64, out io.Writer) (*dashboard, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, err
+	}
+	d := &dashboard{attacker: attacker, targets: targets, tty: tty, out: out, rate: rate}
+	// Keys are read as they are pressed, without being echoed
+	if d.stty, err = stty(tty, "-g"); err != nil {
+		tty.Close()
+		return nil, err
+	}
+	if _, err = stty(tty, "-icanon", "-echo", "min", "1"); err != nil {
+		tty.Close()
+		return nil, err
+	}
+
+	log.SetOutput(d)
+	// Interrupting stops the attack, which leaves the terminal as it was
+	d.sigc = make(chan os.Signal, 1)
+	signal.Notify(d.sigc, os.Interrupt)
+	go func() {
+		for range d.sigc {
+			attacker.Stop()
+		}
+	}()
+	go d.keys()
+
+	// Alternate screen without cursor
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	d.draw()
+	return d, nil
+}
+
+// close gives the terminal back as it was
+func (d *dashboard) close() {
+	signal.Stop(d.sigc)
+	close(d.sigc)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+	stty(d.tty, d.stty)
+	d.tty.Close()
+	log.SetOutput(os.Stderr)
+}
+
+// keys handles the keys pressed until the terminal is closed
+func (d *dashboard) keys() {
+	key := make([]byte, 1)
+	for {
+		if _, err := d.tty.Read(key); err != nil {
+			return
+		}
+		if d.handleKey(key[0]) {
+			d.draw()
+		}
+	}
+}
+
+// handleKey controls the attack as told by key and reports whether key is
+// one of the keys of the dashboard
+func (d *dashboard) handleKey(key byte) bool {
+	switch key {
+	case 'p', ' ':
+		if d.attacker.Paused() {
+			d.attacker.Resume()
+		} else {
+			d.attacker.Pause()
+		}
+	case '+', '=':
+		d.adjust(1)
+	case '-', '_':
+		d.adjust(-1)
+	case 'q':
+		d.attacker.Stop()
+	default:
+		return false
+	}
+	return true
+}
+
+// adjust changes the rate of the attack by a tenth in the direction of
+// sign, in rate mode
+func (d *dashboard) adjust(sign int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.rate == 0 {
+		return
+	}
+	step := d.rate / 10
+	if step == 0 {
+		step = 1
+	}
+	if sign > 0 {
+		d.rate += step
+	} else if d.rate > step {
+		d.rate -= step
+	}
+	d.attacker.AdjustRate(d.rate)
+}
+
+// update adds the Progress p of the attack and draws it
+func (d *dashboard) update(p stress.Progress) {
+	d.mu.Lock()
+	if secs := p.Interval.Seconds(); secs > 0 && !p.Done {
+		d.throughput = append(d.throughput, float64(p.Results-d.results)/secs)
+		d.latencies = append(d.latencies, float64(p.P99))
+		if len(d.throughput) > dashboardHistory {
+			d.throughput = d.throughput[1:]
+			d.latencies = d.latencies[1:]
+		}
+	}
+	d.results, d.last = p.Results, &p
+	d.mu.Unlock()
+	d.draw()
+}
+
+// Write shows the last log lines in the dashboard
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		d.logs = append(d.logs, line)
+	}
+	if len(d.logs) > 5 {
+		d.logs = d.logs[len(d.logs)-5:]
+	}
+	return len(p), nil
+}
+
+// draw draws the dashboard over the whole terminal
+func (d *dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rows, cols := 24, 80
+	if size, err := stty(d.tty, "size"); err == nil {
+		fmt.Sscan(size, &rows, &cols)
+	}
+
+	// The logs and the keys stick to the bottom
+	var footer []string
+	for _, line := range d.logs {
+		footer = append(footer, " "+line)
+	}
+	if d.rate > 0 {
+		footer = append(footer, " [p] pause/resume  [+/-] rate ±10%  [q] stop")
+	} else {
+		footer = append(footer, " [p] pause/resume  [q] stop")
+	}
+
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	state := "running"
+	if d.attacker.Paused() {
+		state = "PAUSED"
+	}
+	if d.rate > 0 {
+		add(" stress attack of %d targets at %d/s [%s]", len(d.targets), d.rate, state)
+	} else {
+		add(" stress attack of %d targets [%s]", len(d.targets), state)
+	}
+	add("")
+
+	if p := d.last; p != nil {
+		add(" Elapsed %s  Remaining %s  Requests %d/%d  Rate %.2f/s  In flight %d",
+			p.Elapsed.Round(time.Second), p.Remaining.Round(time.Second),
+			p.Requests, p.Total, p.Rate, p.InFlight)
+		add("")
+
+		throughput, latency := "", ""
+		if n := len(d.throughput); n > 0 {
+			throughput = fmt.Sprintf("%.2f/s", d.throughput[n-1])
+			latency = time.Duration(d.latencies[n-1]).String()
+		}
+		add(" Throughput   %s  %s", sparkline(d.throughput, cols-28), throughput)
+		add(" Latency p99  %s  %s", sparkline(d.latencies, cols-28), latency)
+		add("")
+
+		m := p.Metrics
+		add(" Success %.2f%%  Latencies mean %s, 50 %s, 95 %s, 99 %s, max %s",
+			m.Success*100, m.Latencies.Mean, m.Latencies.P50, m.Latencies.P95,
+			m.Latencies.P99, m.Latencies.Max)
+		codes := make([]string, 0, len(m.StatusCodes))
+		for code, count := range m.StatusCodes {
+			codes = append(codes, code+":"+strconv.Itoa(count))
+		}
+		sort.Strings(codes)
+		add(" Status codes %s", strings.Join(codes, "  "))
+		add("")
+
+		add(" Top errors")
+		for _, e := range stress.TopErrors(p.ErrorCounts, 5) {
+			add(" %8d  %s", e.Count, e.Error)
+		}
+		add("")
+
+		name := cols - 48
+		if name < 10 {
+			name = 10
+		}
+		add(" %-*s %10s %8s %12s %12s", name, "Targets", "Requests", "Success", "P50", "P99")
+		for i, tm := range p.Targets {
+			if tm == nil || len(lines) >= rows-len(footer)-1 {
+				continue
+			}
+			tgt := d.targets[i].Method + " " + d.targets[i].URL
+			add(" %-*s %10d %7.2f%% %12s %12s", name, truncate(tgt, name),
+				tm.Requests, tm.Success*100, tm.Latencies.P50, tm.Latencies.P99)
+		}
+	}
+
+	if n := rows - len(footer); len(lines) > n && n >= 0 {
+		lines = lines[:n]
+	}
+	for len(lines)+len(footer) < rows {
+		lines = append(lines, "")
+	}
+	lines = append(lines, footer...)
+
+	var frame bytes.Buffer
+	frame.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i >= rows {
+			break
+		}
+		if i > 0 {
+			frame.WriteString("\r\n")
+		}
+		frame.WriteString(truncate(line, cols))
+		frame.WriteString("\x1b[K")
+	}
+	frame.WriteString("\x1b[J")
+	d.out.Write(frame.Bytes())
+}
+
+// sparkline draws the last width values as a sparkline scaled to their max
+func sparkline(values []float64, width int) string {
+	if width < 1 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	var top float64
+	for _, v := range values {
+		if v > top {
+			top = v
+		}
+	}
+	ticks := []rune("▁▂▃▄▅▆▇█")
+	line := make([]rune, 0, width)
+	for _, v := range values {
+		i := 0
+		if top > 0 {
+			i = int(v / top * float64(len(ticks)-1))
+		}
+		line = append(line, ticks[i])
+	}
+	for len(line) < width {
+		line = append(line, ' ')
+	}
+	return string(line)
+}
+
+// truncate truncates s to width runes
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// stty runs stty with args on tty and returns its output
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	stress "github.com/buaazp/stress/lib"
+)
+
+func TestSparkline(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		values []float64
+		width  int
+		want   string
+	}{
+		{[]float64{0, 1, 2, 4, 8}, 5, "▁▁▂▄█"},
+		{[]float64{1, 1}, 4, "██  "},
+		{[]float64{0, 0}, 2, "▁▁"},
+		// Only the last values fit
+		{[]float64{8, 0, 8}, 2, "▁█"},
+		{nil, 0, ""},
+	} {
+		if got := sparkline(tc.values, tc.width); got != tc.want {
+			t.Errorf("sparkline(%v, %d): want %q, got %q", tc.values, tc.width, tc.want, got)
+		}
+	}
+}
+
+func TestDashboardKeys(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	atk := stress.NewAttacker(stress.DefaultRedirects, stress.DefaultTimeout, stress.DefaultLocalAddr)
+	d := &dashboard{attacker: atk, rate: 100}
+	done := make(chan stress.Results)
+	go func() {
+		done <- atk.AttackRate(stress.Targets{{Method: "GET", URL: server.URL}}, 100, 10*time.Second)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if d.handleKey('x') {
+		t.Error("Unknown keys shouldn't be handled")
+	}
+	if !d.handleKey('p') || !atk.Paused() {
+		t.Error("p should pause the attack")
+	}
+	if !d.handleKey(' ') || atk.Paused() {
+		t.Error("Space should resume the attack")
+	}
+
+	for _, tc := range []struct {
+		key  byte
+		want uint64
+	}{
+		{'+', 110},
+		{'=', 121},
+		{'-', 109},
+		{'_', 99},
+	} {
+		if !d.handleKey(tc.key) || d.rate != tc.want {
+			t.Errorf("%c: wrong rate. Want: %d, Got: %d", tc.key, tc.want, d.rate)
+		}
+	}
+	// Attacks in concurrency mode have no rate to change
+	concy := &dashboard{attacker: atk}
+	if concy.handleKey('+'); concy.rate != 0 {
+		t.Errorf("Wrong rate in concurrency mode: %d", concy.rate)
+	}
+
+	if !d.handleKey('q') {
+		t.Error("q should stop the attack")
+	}
+	select {
+	case results := <-done:
+		if m := stress.NewMetrics(results); m.Stopped != stress.ErrStopped.Error() {
+			t.Errorf("The results should tell the attack was stopped: %q", m.Stopped)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The attack should have stopped")
+	}
+}
@@ -1,25 +1,83 @@
 package stress
 
 import (
-	"crypto/md5"
+	"bytes"
+	"context"
 	"crypto/tls"
-	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-var (
-	remain int64
+// Attacker is an attack executor which wraps an http.Client
+type Attacker struct {
+	client    http.Client
+	transport *http.Transport
+	dialer    *net.Dialer
+	timeouts  Timeouts
+	auth      Authenticator
+	proxy     func(*http.Request) (*url.URL, error)
+	conns     sync.Map
+	network   Network
+	breaker   *Breaker
+	stream    io.Writer
+	progress  []progressFunc
+	cookies   bool
+	users     uint64
+	chunkSize int
+
+	acceptEncoding string
+
+	requestHooks  []RequestHook
+	responseHooks []ResponseHook
+
+	mu      sync.Mutex
+	running *attack
+}
+
+// Timeouts bounds the phases of every request. Zero disables a timeout.
+type Timeouts struct {
+	// Connect bounds dialing the connection
+	Connect time.Duration
+	// TLS bounds the TLS handshake
+	TLS time.Duration
+	// Header bounds awaiting the response headers once the request is sent
+	Header time.Duration
+	// Body bounds reading the response body
+	Body time.Duration
+	// Total bounds the whole request, replaced by the Target Timeout
+	Total time.Duration
+}
+
+// Kinds of timeouts a Result may fail with
+const (
+	TimeoutConnect = "connect"
+	TimeoutTLS     = "tls"
+	TimeoutHeader  = "header"
+	TimeoutBody    = "body"
+	TimeoutTotal   = "total"
 )
 
-// Attacker is an attack executor which wraps an http.Client
-type Attacker struct{ client http.Client }
+// Session holds the state of a single worker in concurrency mode or of a
+// single virtual user in rate mode. When cookies are enabled each Session
+// owns its cookie jar, so cookies set by the target are sent back only by
+// the worker which received them.
+type Session struct {
+	ID     int
+	client http.Client
+}
 
 var (
 	// DefaultRedirects represents the number of times the DefaultAttacker
@@ -31,6 +89,17 @@ var (
 	// DefaultLocalAddr is the local IP address the DefaultAttacker uses in its
 	// requests
 	DefaultLocalAddr = net.IPAddr{IP: net.IPv4zero}
+	// DefaultUsers represents the number of virtual users the DefaultAttacker
+	// spreads its requests over in rate mode
+	DefaultUsers uint64 = 1
+	// DefaultTimeouts are sensible Timeouts to be set with SetTimeouts
+	DefaultTimeouts = Timeouts{
+		Connect: 10 * time.Second,
+		TLS:     10 * time.Second,
+		Header:  30 * time.Second,
+		Body:    30 * time.Second,
+		Total:   60 * time.Second,
+	}
 )
 
 // DefaultAttacker is the default Attacker used by Attack
@@ -41,33 +110,95 @@ var DefaultAttacker = NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocal
 // redirects is the max amount of redirects the attacker will follow.
 // Use DefaultRedirects for a sensible default.
 //
-// timeout is the client side timeout for each request.
-// Use DefaultTimeout for a sensible default.
+// timeout bounds dialing and awaiting the response headers of each request.
+// Use DefaultTimeout for a sensible default, or SetTimeouts to bound every
+// phase of the requests.
 //
 // laddr is the local IP address used for each request.
 // Use DefaultLocalAddr for a sensible default.
 func NewAttacker(redirects int, timeout time.Duration, laddr net.IPAddr) *Attacker {
-	return &Attacker{http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			Dial: (&net.Dialer{
-				Timeout:   timeout,
-				KeepAlive: 30 * time.Second,
-				LocalAddr: &net.TCPAddr{IP: laddr.IP, Zone: laddr.Zone},
-			}).Dial,
-			ResponseHeaderTimeout: timeout,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			TLSHandshakeTimeout: 10 * time.Second,
+	dialer := &net.Dialer{
+		KeepAlive: 30 * time.Second,
+		LocalAddr: &net.TCPAddr{IP: laddr.IP, Zone: laddr.Zone},
+	}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
 		},
-		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-			if len(via) > redirects {
-				return fmt.Errorf("stopped after %d redirects", redirects)
+		ExpectContinueTimeout: 1 * time.Second,
+		// Responses are decoded by the Attacker, which records their size
+		// as received
+		DisableCompression: true,
+	}
+	a := &Attacker{transport: transport, dialer: dialer, users: DefaultUsers, acceptEncoding: "gzip"}
+	transport.Proxy = a.proxyFor
+	transport.DialContext = a.dial
+	a.SetTimeouts(Timeouts{Connect: timeout, TLS: 10 * time.Second, Header: timeout})
+	a.client = http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			max := redirects
+			switch n, _ := req.Context().Value(redirectsKey{}).(int); {
+			case n == NoRedirects:
+				return http.ErrUseLastResponse
+			case n > 0:
+				max = n
+			}
+			if len(via) > max {
+				return fmt.Errorf("stopped after %d redirects", max)
 			}
 			return nil
 		},
-	}}
+	}
+	return a
+}
+
+// SetTimeouts sets the Timeouts bounding every phase of the requests.
+func (a *Attacker) SetTimeouts(t Timeouts) {
+	a.timeouts = t
+	a.dialer.Timeout = t.Connect
+	a.transport.TLSHandshakeTimeout = t.TLS
+	a.transport.ResponseHeaderTimeout = t.Header
+}
+
+// SetCookies enables or disables a cookie jar per Session. With cookies
+// enabled every worker (or virtual user in rate mode) keeps the cookies the
+// target sets, which allows session based flows to be attacked.
+func (a *Attacker) SetCookies(enabled bool) { a.cookies = enabled }
+
+// SetUsers sets the number of virtual users AttackRate spreads its requests
+// over. Each virtual user is backed by its own Session.
+func (a *Attacker) SetUsers(users uint64) {
+	if users == 0 {
+		users = 1
+	}
+	a.users = users
+}
+
+// SetAuth sets the Authenticator of every request, nil disabling it.
+func (a *Attacker) SetAuth(auth Authenticator) { a.auth = auth }
+
+// SetChunkSize sets the size of the chunks request bodies are written in.
+// It sets the size of every chunk of requests sent with chunked transfer
+// encoding. Zero leaves it up to the transport.
+func (a *Attacker) SetChunkSize(size int) { a.chunkSize = size }
+
+// SetStream sets the writer every Result is written to as a JSON line as
+// soon as it comes back, in the order they come back, so that results can
+// be piped to a report while the attack is running. Results are still
+// returned once the attack is done. The attack is stopped when writing
+// fails. A nil writer disables streaming.
+func (a *Attacker) SetStream(out io.Writer) { a.stream = out }
+
+// newSession returns a new Session identified by id which shares the
+// Attacker transport and, if cookies are enabled, owns a fresh cookie jar.
+func (a *Attacker) newSession(id int) *Session {
+	s := &Session{ID: id, client: a.client}
+	if a.cookies {
+		// cookiejar.New never fails with nil options
+		s.client.Jar, _ = cookiejar.New(nil)
+	}
+	return s
 }
 
 // AttackRate hits the passed Targets (http.Requests) at the rate specified for
@@ -83,77 +214,334 @@ func AttackRate(tgts Targets, rate uint64, du time.Duration) Results {
 // duration time and then waits for all the requests to come back.
 // The results of the attack are put into a slice which is returned.
 func (a *Attacker) AttackRate(tgts Targets, rate uint64, du time.Duration) Results {
+	tgts = tgts.prepared()
 	hits := int(rate * uint64(du.Seconds()))
-	resc := make(chan Result)
 	throttle := time.NewTicker(time.Duration(1e9 / rate))
 	defer throttle.Stop()
 
-	for i := 0; i < hits; i++ {
-		<-throttle.C
-		go func(tgt Target) { resc <- a.hit(tgt) }(tgts[i%len(tgts)])
+	sessions := make([]*Session, a.users)
+	for i := range sessions {
+		sessions[i] = a.newSession(i)
+	}
+
+	at := newAttack(hits, du)
+	a.run(at)
+	defer a.run(nil)
+	done := at.collect(a)
+	var wg sync.WaitGroup
+loop:
+	for i := 0; i < at.planned(); {
+		select {
+		case <-at.stopc:
+			break loop
+		case rate := <-at.ratec:
+			throttle.Reset(time.Duration(1e9 / rate))
+			at.replan(i, rate)
+			continue
+		case <-throttle.C:
+		}
+		if !at.wait() {
+			break loop
+		}
+		wg.Add(1)
+		go func(tgt, s int) {
+			defer wg.Done()
+			a.fire(at, tgts, tgt, sessions[s])
+		}(i%len(tgts), i%len(sessions))
+		i++
+	}
+	wg.Wait()
+	close(at.resc)
+
+	return (<-done).Sort()
+}
+
+// attack holds the state shared by the workers of a single attack, which
+// plans to send total requests, for duration in rate mode
+type attack struct {
+	sent     uint64
+	total    int64
+	resc     chan Result
+	stopc    chan struct{}
+	once     sync.Once
+	err      error
+	start    time.Time
+	duration time.Duration
+	control
+}
+
+func newAttack(total int, duration time.Duration) *attack {
+	return &attack{
+		total:    int64(total),
+		resc:     make(chan Result),
+		stopc:    make(chan struct{}),
+		start:    time.Now(),
+		duration: duration,
+		control:  control{ratec: make(chan uint64, 1)},
 	}
-	results := make(Results, 0, hits)
-	for len(results) < cap(results) {
-		results = append(results, <-resc)
+}
+
+// planned returns the number of requests the attack plans to send
+func (at *attack) planned() int { return int(atomic.LoadInt64(&at.total)) }
+
+// stop ends the attack early because of err. Only the first reason is kept.
+func (at *attack) stop(err error) {
+	at.once.Do(func() {
+		at.err = err
+		log.Printf("Stopping the attack: %s\n", err)
+		close(at.stopc)
+	})
+}
+
+// stopped reports whether the attack was stopped early
+func (at *attack) stopped() bool {
+	select {
+	case <-at.stopc:
+		return true
+	default:
+		return false
 	}
+}
 
-	return results.Sort()
+// collect gathers the results sent by the workers until resc is closed and
+// then hands them over on the returned channel. The attack is stopped as
+// soon as the results trip the Breaker of a, if any, and a result tells
+// when it was stopped on demand. Results are streamed and their Progress
+// reported as told by a while they are gathered.
+func (at *attack) collect(a *Attacker) <-chan Results {
+	done := make(chan Results, 1)
+	go func() {
+		results := make(Results, 0, at.planned())
+		var w *breakerWindow
+		if a.breaker != nil {
+			w = &breakerWindow{Breaker: a.breaker}
+		}
+		var enc *json.Encoder
+		if a.stream != nil {
+			enc = json.NewEncoder(a.stream)
+		}
+		// Attacks stopped on demand tell so on the first result collected
+		// once stopped, or on the last one
+		onDemand := func() bool { return at.stopped() && at.err == ErrStopped }
+		told := false
+		var meter *progressMeter
+		var tick <-chan time.Time
+		if len(a.progress) > 0 {
+			meter = newProgressMeter(at, a.progress)
+			ticker := time.NewTicker(meter.every)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			var res Result
+			select {
+			case now := <-tick:
+				meter.tick(now)
+				continue
+			case r, ok := <-at.resc:
+				if !ok {
+					if n := len(results); !told && n > 0 && onDemand() {
+						results[n-1].Stopped = ErrStopped.Error()
+					}
+					if meter != nil {
+						meter.done(time.Now())
+					}
+					done <- results
+					return
+				}
+				res = r
+			}
+			if !told && onDemand() {
+				res.Stopped, told = ErrStopped.Error(), true
+			}
+			if meter != nil {
+				meter.add(res)
+			}
+			if w != nil && !at.stopped() {
+				if res.Stopped = w.add(res, time.Now()); res.Stopped != "" {
+					at.stop(errors.New(res.Stopped))
+				}
+			}
+			if enc != nil {
+				if err := enc.Encode(res); err != nil {
+					at.stop(fmt.Errorf("streaming results: %s", err))
+					enc = nil
+				}
+			}
+			results = append(results, res)
+		}
+	}()
+	return done
 }
 
-func (a *Attacker) hit(tgt Target) (res Result) {
-	req, err := tgt.Request()
+// redirectsKey is the context key of the number of redirects to follow
+// for a Target
+type redirectsKey struct{}
+
+// fire hits the Target i of tgts on behalf of s and sends the results of
+// every attempt to the attack, retrying as told by the Target retry policy.
+// Requests which could not be built because the attack must end stop it
+// instead.
+func (a *Attacker) fire(at *attack, tgts Targets, i int, s *Session) {
+	tgt := tgts[i]
+	data, err := tgt.next(s)
 	if err != nil {
-		res.Error = err.Error()
-		return res
+		at.stop(err)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		var res Result
+		// Retries are built out of the same template data and feeder row
+		req, err := tgt.request(data)
+		if err == nil && a.auth != nil {
+			if err = a.auth.Authenticate(req); err != nil && req.Body != nil {
+				req.Body.Close()
+			}
+		}
+		atomic.AddUint64(&at.sent, 1)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res = a.hit(tgt, req, s)
+		}
+		res.Attempt = attempt
+		res.target = i
+		res.Retried = err == nil && attempt <= tgt.Retry.Count && tgt.Retry.retries(res)
+		at.resc <- res
+		if !res.Retried {
+			return
+		}
+
+		select {
+		case <-at.stopc:
+			return
+		case <-time.After(tgt.Retry.backoff(attempt)):
+		}
+	}
+}
+
+// hit sends a single request built out of tgt on behalf of s
+func (a *Attacker) hit(tgt Target, req *http.Request, s *Session) (res Result) {
+	// The Target Timeout replaces the Total one, longer or shorter
+	timeout := a.timeouts.Total
+	if tgt.Timeout > 0 {
+		timeout = tgt.Timeout
+	}
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	if tgt.Redirects != 0 {
+		req = req.WithContext(context.WithValue(req.Context(), redirectsKey{}, tgt.Redirects))
+	}
+
+	if tgt.proxy != nil {
+		if tgt.proxy.err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			res.Timestamp, res.Error = time.Now(), tgt.proxy.err.Error()
+			return res
+		}
+		req = req.WithContext(context.WithValue(req.Context(), proxyKey{}, *tgt.proxy))
+	}
+	p := &phases{conns: &a.conns}
+	req = req.WithContext(p.trace(req.Context()))
+	defer p.record(&res)
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body := &countingBody{ReadCloser: req.Body, chunk: a.chunkSize}
+		req.Body = body
+		// Count what was sent, even if the upload was cut short
+		defer func() { res.BytesOut = uint64(atomic.LoadInt64(&body.n)) }()
+	}
+
+	var bodyTimer *time.Timer
+	if a.timeouts.Body > 0 {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		req = req.WithContext(ctx)
+		// Armed once the response headers are in
+		bodyTimer = time.AfterFunc(time.Duration(math.MaxInt64), cancel)
+		defer bodyTimer.Stop()
+	}
+
+	if a.acceptEncoding != "" && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", a.acceptEncoding)
+	}
+	for _, h := range a.requestHooks {
+		h.BeforeRequest(req)
+	}
+	// Signatures cover the request as it is sent
+	if tgt.signer != nil {
+		var err error
+		if req, err = tgt.sign(req); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			res.Timestamp, res.Error = time.Now(), err.Error()
+			return res
+		}
 	}
 
 	res.Timestamp = time.Now()
-	r, err := a.client.Do(req)
+	r, err := s.client.Do(req)
 	if err != nil {
-		res.Error = err.Error()
+		res.Error, res.Timeout = err.Error(), timeoutKind(err)
 		return res
 	}
+	defer r.Body.Close()
 
-	res.BytesOut = uint64(req.ContentLength)
 	res.Code = uint16(r.StatusCode)
+	if bodyTimer != nil {
+		bodyTimer.Reset(a.timeouts.Body)
+	}
 	body, err := ioutil.ReadAll(r.Body)
+	res.Latency = time.Since(res.Timestamp)
 	if err != nil {
-		if res.Code >= 300 || res.Code < 200 {
-			res.Error = fmt.Sprintf("%s %s: %s", tgt.Method, tgt.URL, r.Status)
+		res.Error = fmt.Sprintf("%s %s: %s", tgt.Method, tgt.URL, err)
+		if res.Timeout = timeoutKind(err); res.Timeout == "" && bodyTimer != nil && !bodyTimer.Stop() {
+			res.Timeout = TimeoutBody
+			res.Error = fmt.Sprintf("%s %s: timeout reading body", tgt.Method, tgt.URL)
 		}
 		return res
 	}
 
-	res.Latency = time.Since(res.Timestamp)
+	res.Encoding = r.Header.Get("Content-Encoding")
+	res.BytesInEncoded = uint64(len(body))
+	decoded, ok, err := decodeBody(body, res.Encoding)
+	if err != nil {
+		res.Error = fmt.Sprintf("%s %s: decoding %s body: %s", tgt.Method, tgt.URL, res.Encoding, err)
+		return res
+	}
+	if ok {
+		// Like the transport does when it decodes responses itself
+		body = decoded
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength, r.Uncompressed = -1, true
+	}
 	res.BytesIn = uint64(len(body))
-	if res.Code >= 300 || res.Code < 200 {
+	if len(tgt.Expect.Status) == 0 && (res.Code >= 300 || res.Code < 200) {
 		res.Error = fmt.Sprintf("%s %s: %s", tgt.Method, tgt.URL, r.Status)
-	} else {
-		if strings.Contains(tgt.File, "md5") {
-			//fmt.Printf("checking [%s]\n", tgt.File)
-			kv := strings.Split(tgt.File, ":")
-			/*
-				for k, v := range kv {
-					fmt.Printf("[%d]: %s\n", k, v)
-				}
-			*/
-			if len(kv) == 2 {
-				if kv[1] != "" && len(kv[1]) == 32 {
-					//fmt.Println("checking [%s]\n", kv[1])
-					h := md5.New()
-					h.Write(body)
-					rspMd5 := hex.EncodeToString(h.Sum(nil))
-					if rspMd5 != kv[1] {
-						//fmt.Println("md5 not match!")
-						res.Code = 250
-						res.Error = fmt.Sprintf("%s %s: MD5 not matced", tgt.Method, tgt.URL)
-					}
-				}
-			}
+	} else if err = tgt.Expect.Check(r.StatusCode, body); err != nil {
+		// Failed assertions on successful responses are told apart with 250
+		if res.Code >= 200 && res.Code < 250 {
+			res.Code = 250
 		}
+		res.Error = fmt.Sprintf("%s %s: %s", tgt.Method, tgt.URL, err)
+	} else {
+		res.Expected = len(tgt.Expect.Status) > 0
+	}
+
+	for _, h := range a.responseHooks {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.AfterResponse(r, &res)
 	}
 
-	if res.Code >= 250 || res.Code < 200 {
+	if res.Error != "" {
 		log.Printf("%s\n", res.Error)
 	}
 
@@ -173,96 +561,77 @@ func AttackConcy(tgts Targets, concurrency uint64, number uint64) Results {
 // specified for times and then waits for all the requests to come back.
 // The results of the AttackConcy are put into a slice which is returned.
 func (a *Attacker) AttackConcy(tgts Targets, concurrency uint64, number uint64) Results {
-	retsc := make(chan Results)
-	atomic.StoreInt64(&remain, int64(number))
+	tgts = tgts.prepared()
+	remain := int64(number)
 
 	if concurrency > number {
 		concurrency = number
 	}
 
+	at := newAttack(int(number), 0)
+	a.run(at)
+	defer a.run(nil)
+	done := at.collect(a)
+	var wg sync.WaitGroup
 	var i uint64
 	for i = 0; i < concurrency; i++ {
-		go func(tgts Targets) { retsc <- a.shoot(tgts) }(tgts)
-	}
-	results := make(Results, 0, number)
-	for i = 0; i < concurrency; i++ {
-		results = append(results, <-retsc...)
+		wg.Add(1)
+		go func(s *Session) {
+			defer wg.Done()
+			a.shoot(at, tgts, s, &remain)
+		}(a.newSession(int(i)))
 	}
-	return results.Sort()
-}
+	wg.Wait()
+	close(at.resc)
 
-func (a *Attacker) shoot(tgts Targets) Results {
-	results := make(Results, 0, 1)
-	reqRemain := atomic.LoadInt64(&remain)
-	for reqRemain > 0 {
-		atomic.AddInt64(&remain, -1)
-		var res Result
-		tgt := tgts[int(reqRemain)%len(tgts)]
-		req, err := tgt.Request()
-		if err != nil {
-			res.Error = err.Error()
-			results = append(results, res)
-			reqRemain = atomic.LoadInt64(&remain)
-			continue
-		}
+	return (<-done).Sort()
+}
 
-		res.Timestamp = time.Now()
-		r, err := a.client.Do(req)
-		if err != nil {
-			res.Error = err.Error()
-			results = append(results, res)
-			reqRemain = atomic.LoadInt64(&remain)
-			continue
+// shoot hits the passed Targets one after another on behalf of a single
+// Session until the shared remain counter is exhausted or the attack stops.
+func (a *Attacker) shoot(at *attack, tgts Targets, s *Session, remain *int64) {
+	for at.wait() {
+		n := atomic.AddInt64(remain, -1) + 1
+		if n <= 0 {
+			return
 		}
+		a.fire(at, tgts, int(n)%len(tgts), s)
+	}
+}
 
-		res.BytesOut = uint64(req.ContentLength)
-		res.Code = uint16(r.StatusCode)
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			if res.Code >= 300 || res.Code < 200 {
-				res.Error = fmt.Sprintf("%s %s: %s", tgt.Method, tgt.URL, r.Status)
-			}
-			results = append(results, res)
-			reqRemain = atomic.LoadInt64(&remain)
-			continue
-		}
+// timeoutKind returns the kind of timeout err is, if it is a timeout
+func timeoutKind(err error) string {
+	var opErr *net.OpError
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "TLS handshake timeout"):
+		return TimeoutTLS
+	case strings.Contains(msg, "timeout awaiting response headers"):
+		return TimeoutHeader
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		return TimeoutConnect
+	case errors.Is(err, context.DeadlineExceeded):
+		return TimeoutTotal
+	}
+	return ""
+}
 
-		res.Latency = time.Since(res.Timestamp)
-		res.BytesIn = uint64(len(body))
-		if res.Code >= 300 || res.Code < 200 {
-			res.Error = fmt.Sprintf("%s %s: %s", tgt.Method, tgt.URL, r.Status)
-		} else {
-			if strings.Contains(tgt.File, "md5") {
-				//fmt.Printf("checking [%s]\n", tgt.File)
-				kv := strings.Split(tgt.File, ":")
-				/*
-					for k, v := range kv {
-						fmt.Printf("[%d]: %s\n", k, v)
-					}
-				*/
-				if len(kv) == 2 {
-					if kv[1] != "" && len(kv[1]) == 32 {
-						//fmt.Println("checking [%s]\n", kv[1])
-						h := md5.New()
-						h.Write(body)
-						rspMd5 := hex.EncodeToString(h.Sum(nil))
-						if rspMd5 != kv[1] {
-							//fmt.Println("md5 not match!")
-							res.Code = 250
-							res.Error = fmt.Sprintf("%s %s: MD5 not matced", tgt.Method, tgt.URL)
-						}
-					}
-				}
-			}
-		}
-		if res.Code >= 250 || res.Code < 200 {
-			log.Printf("%s\n", res.Error)
-		}
+// countingBody counts the bytes of a request body read by the transport,
+// which writes them out as it reads them, and hands them out at most chunk
+// bytes at a time when chunk is positive: the transport copies bodies with
+// Read, every read becoming a chunk of a chunked request.
+type countingBody struct {
+	io.ReadCloser
+	n     int64
+	chunk int
+}
 
-		results = append(results, res)
-		reqRemain = atomic.LoadInt64(&remain)
+func (b *countingBody) Read(p []byte) (int, error) {
+	if b.chunk > 0 && len(p) > b.chunk {
+		p = p[:b.chunk]
 	}
-	return results
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(&b.n, int64(n))
+	return n, err
 }
 
 var defaultTransport = http.Transport{
@@ -3,10 +3,12 @@ package stress
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -116,6 +118,62 @@ func TestTimeout(t *testing.T) {
 	}
 }
 
+func TestTimeouts(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/body" {
+				w.WriteHeader(200)
+				w.(http.Flusher).Flush()
+			}
+			<-time.After(100 * time.Millisecond)
+		}),
+	)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		// Accept connections without ever completing a TLS handshake
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(ioutil.Discard, conn)
+			}()
+		}
+	}()
+
+	for url, c := range map[string]struct {
+		timeouts Timeouts
+		want     string
+	}{
+		server.URL + "/header":          {Timeouts{Header: 20 * time.Millisecond}, TimeoutHeader},
+		server.URL + "/body":            {Timeouts{Body: 20 * time.Millisecond}, TimeoutBody},
+		server.URL + "/total":           {Timeouts{Total: 20 * time.Millisecond}, TimeoutTotal},
+		"https://" + ln.Addr().String(): {Timeouts{TLS: 20 * time.Millisecond}, TimeoutTLS},
+	} {
+		atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+		atk.SetTimeouts(c.timeouts)
+		results := atk.AttackConcy(Targets{{Method: "GET", URL: url}}, 1, 1)
+		if len(results) != 1 || results[0].Timeout != c.want || results[0].Error == "" {
+			t.Errorf("%s: expected a %s timeout, Got: %+v", url, c.want, results)
+		} else if results[0].Success() {
+			t.Errorf("%s: expected a %s timeout not to succeed", url, c.want)
+		}
+	}
+
+	dialErr := &net.OpError{Op: "dial", Err: &net.DNSError{IsTimeout: true}}
+	if got := timeoutKind(dialErr); got != TimeoutConnect {
+		t.Errorf("Expected a connect timeout, Got: %q", got)
+	}
+}
+
 func TestLocalAddr(t *testing.T) {
 	t.Parallel()
 
@@ -146,3 +204,268 @@ func TestLocalAddr(t *testing.T) {
 		}
 	}
 }
+
+func TestCookies(t *testing.T) {
+	t.Parallel()
+
+	var anonymous uint64
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := r.Cookie("session"); err != nil {
+				atomic.AddUint64(&anonymous, 1)
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "lolcat"})
+			}
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.SetCookies(true)
+	tgt := Target{Method: "GET", URL: server.URL}
+	for _, result := range atk.AttackConcy(Targets{tgt}, 4, 40) {
+		if result.Error != "" {
+			t.Fatal(result.Error)
+		}
+	}
+
+	// Only the first hit of each worker may come without the cookie
+	if got := atomic.LoadUint64(&anonymous); got == 0 || got > 4 {
+		t.Fatalf("Expected anonymous hits to be between 1 and 4, Got: %d", got)
+	}
+}
+
+func TestTargetTimeout(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				<-time.After(50 * time.Millisecond)
+			}
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	tgts := Targets{
+		{Method: "GET", URL: server.URL + "/slow", Timeout: 10 * time.Millisecond},
+		{Method: "GET", URL: server.URL + "/slow"},
+	}
+	results := atk.AttackConcy(tgts, 1, 2)
+
+	errs := 0
+	for _, result := range results {
+		if result.Error != "" {
+			errs++
+		}
+	}
+	if errs != 1 {
+		t.Fatalf("Only the target with a short timeout should fail: %v", results)
+	}
+
+	// A longer Target Timeout extends the Total one
+	atk.SetTimeouts(Timeouts{Total: 10 * time.Millisecond})
+	tgts = Targets{{Method: "GET", URL: server.URL + "/slow", Timeout: time.Second}}
+	if results = atk.AttackConcy(tgts, 1, 1); len(results) != 1 || results[0].Error != "" {
+		t.Fatalf("The target timeout should replace the total one: %v", results)
+	}
+}
+
+func TestTargetRedirects(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/done" {
+				http.Redirect(w, r, "/done", 302)
+			}
+		}),
+	)
+
+	atk := NewAttacker(0, DefaultTimeout, DefaultLocalAddr)
+	tgts := Targets{
+		{Method: "GET", URL: server.URL + "/a", Redirects: 1},
+		{Method: "GET", URL: server.URL + "/b", Redirects: NoRedirects, Expect: Expect{Status: []int{302}}},
+		{Method: "GET", URL: server.URL + "/c"},
+	}
+	results := atk.AttackConcy(tgts, 1, 3)
+
+	codes := map[uint16]int{}
+	for _, result := range results {
+		codes[result.Code]++
+	}
+	if codes[200] != 1 || codes[302] != 1 || codes[0] != 1 {
+		t.Fatalf("Wrong redirects per target: %v", results)
+	}
+}
+
+func TestExpectStatus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.NotFoundHandler())
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	tgts := Targets{
+		{Method: "GET", URL: server.URL, Expect: Expect{Status: []int{404}}},
+		{Method: "GET", URL: server.URL, Expect: Expect{Status: []int{404}, Contains: "lolcat"}},
+		{Method: "GET", URL: server.URL},
+	}
+	results := atk.AttackConcy(tgts, 1, 3)
+	sort.Slice(results, func(i, j int) bool { return results[i].target < results[j].target })
+
+	if res := results[0]; res.Code != 404 || res.Error != "" || !res.Expected || !res.Success() {
+		t.Errorf("An expected status should succeed: %+v", res)
+	}
+	for _, res := range results[1:] {
+		if res.Error == "" || res.Expected || res.Success() {
+			t.Errorf("An unexpected response should fail: %+v", res)
+		}
+	}
+	if m := NewMetrics(results); m.Success < 0.33 || m.Success > 0.34 {
+		t.Errorf("Wrong success ratio: %f", m.Success)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	var hits uint64
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddUint64(&hits, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	tgt := Target{Method: "GET", URL: server.URL, Retry: Retry{Count: 5, Backoff: time.Millisecond, Statuses: []int{503}}}
+	results := atk.AttackConcy(Targets{tgt}, 1, 1)
+
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 attempts, Got: %v", results)
+	}
+	for i, result := range results {
+		if want := i + 1; result.Attempt != want || result.Retried != (want < 3) {
+			t.Errorf("Wrong attempt %d: %+v", want, result)
+		}
+	}
+
+	m := NewMetrics(results)
+	if m.Attempts.Retries != 2 || m.Attempts.FirstSuccess != 0 || m.Attempts.EventualSuccess != 1 {
+		t.Errorf("Wrong attempts metrics: %+v", m.Attempts)
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	t.Parallel()
+
+	body := bytes.Repeat([]byte("lolcat"), 100000)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TransferEncoding) == 0 || r.TransferEncoding[0] != "chunked" {
+				t.Errorf("Expected chunked transfer encoding, Got: %v", r.TransferEncoding)
+			}
+			got, err := ioutil.ReadAll(r.Body)
+			if err != nil || !bytes.Equal(got, body) {
+				t.Errorf("Wrong body of %d bytes: %v", len(got), err)
+			}
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.SetChunkSize(4096)
+	tgt := Target{
+		Method: "PUT",
+		URL:    server.URL,
+		Body:   body,
+		Header: http.Header{"Transfer-Encoding": []string{"chunked"}},
+	}
+	for _, result := range atk.AttackConcy(Targets{tgt}, 1, 2) {
+		if result.Error != "" {
+			t.Fatal(result.Error)
+		}
+		if result.BytesOut != uint64(len(body)) {
+			t.Fatalf("Wrong BytesOut. Want: %d, Got: %d", len(body), result.BytesOut)
+		}
+	}
+}
+
+func TestRejectedUpload(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	tgt := Target{
+		Method: "PUT",
+		URL:    server.URL,
+		Body:   make([]byte, 1<<20),
+		Header: http.Header{"Expect": []string{"100-continue"}},
+	}
+	for _, result := range atk.AttackConcy(Targets{tgt}, 1, 1) {
+		if result.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("Wrong status code: %d", result.Code)
+		}
+		if result.BytesOut != 0 {
+			t.Fatalf("Rejected upload shouldn't be sent. Got BytesOut: %d", result.BytesOut)
+		}
+	}
+}
+
+// writeSizes records the size of every write
+type writeSizes []int
+
+func (w *writeSizes) Write(p []byte) (int, error) {
+	*w = append(*w, len(p))
+	return len(p), nil
+}
+
+func TestCountingBodyChunks(t *testing.T) {
+	t.Parallel()
+
+	body := &countingBody{ReadCloser: ioutil.NopCloser(bytes.NewReader(make([]byte, 10))), chunk: 4}
+	// Like the transport copies bodies
+	var sizes writeSizes
+	if n, err := io.Copy(&sizes, body); err != nil || n != 10 {
+		t.Fatalf("Wrong copy: %d, %v", n, err)
+	}
+	if want := (writeSizes{4, 4, 2}); fmt.Sprint(sizes) != fmt.Sprint(want) {
+		t.Fatalf("Wrong chunks. Want: %v, Got: %v", want, sizes)
+	}
+	if body.n != 10 {
+		t.Fatalf("Wrong count. Want: 10, Got: %d", body.n)
+	}
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	var out bytes.Buffer
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.SetStream(&out)
+	results := atk.AttackConcy(Targets{{Method: "GET", URL: server.URL}}, 2, 10)
+
+	// Every result is a JSON line
+	if lines := strings.Count(out.String(), "\n"); lines != len(results) {
+		t.Fatalf("Wrong number of lines. Want: %d, Got: %d", len(results), lines)
+	}
+	var streamed Results
+	if err := streamed.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != 10 {
+		t.Fatalf("Wrong number of streamed results. Want: 10, Got: %d", len(streamed))
+	}
+	for i, res := range streamed.Sort() {
+		if res.Code != 200 || !res.Timestamp.Equal(results[i].Timestamp) {
+			t.Errorf("Wrong result %d. Want: %+v, Got: %+v", i, results[i], res)
+		}
+	}
+}
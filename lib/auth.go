@@ -0,0 +1,234 @@
+package stress
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator authenticates the requests sent by an Attacker. Requests
+// which fail to be authenticated are not sent, their Result holding the
+// error instead.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// BasicAuth authenticates requests with HTTP basic authentication
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate sets the basic authentication of req
+func (b BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(b.Username, b.Password)
+	return nil
+}
+
+// BearerToken authenticates requests with a static bearer token
+type BearerToken string
+
+// Authenticate sets the bearer token of req
+func (t BearerToken) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// TokenStats tracks the token fetches of an OAuth2 Authenticator apart from
+// the results of the attack
+type TokenStats struct {
+	Fetches  uint64
+	Failures uint64
+	// Total and Max are the total and the max latency of the fetches
+	Total     time.Duration
+	Max       time.Duration
+	LastError string
+}
+
+// Mean returns the mean latency of the token fetches
+func (s TokenStats) Mean() time.Duration {
+	if s.Fetches == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Fetches)
+}
+
+// OAuth2 authenticates requests with a bearer token obtained from a token
+// endpoint with the OAuth2 client credentials grant. The token is fetched
+// again in the background shortly before it expires, requests going on with
+// the current one meanwhile, and one fetch at most is in flight at a time. A
+// failed fetch fails the requests without a valid token for a short backoff
+// before the token is fetched again, rather than hammering the token endpoint
+// with every request. An OAuth2 is safe for concurrent use.
+type OAuth2 struct {
+	tokenURL string
+	form     url.Values
+	clientID string
+	secret   string
+	client   *http.Client
+	now      func() time.Time
+
+	mu       sync.RWMutex
+	token    string
+	renew    time.Time
+	expiry   time.Time
+	failure  error
+	retry    time.Time
+	fetching chan struct{}
+	stats    TokenStats
+}
+
+const (
+	// maxExpiryDelta bounds how early tokens are fetched again before they expire
+	maxExpiryDelta = 10 * time.Second
+	// tokenBackoff is how long a failed token fetch fails the requests for
+	tokenBackoff = time.Second
+)
+
+// NewOAuth2 returns an OAuth2 Authenticator fetching tokens from tokenURL
+// on behalf of the passed client, for the passed scopes if any.
+func NewOAuth2(tokenURL, clientID, secret string, scopes []string) *OAuth2 {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	return &OAuth2{
+		tokenURL: tokenURL,
+		form:     form,
+		clientID: clientID,
+		secret:   secret,
+		client: &http.Client{
+			Timeout: DefaultTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		now: time.Now,
+	}
+}
+
+// Authenticate sets the current token on req, waiting for a new one to be
+// fetched if there is none or if it expired
+func (o *OAuth2) Authenticate(req *http.Request) error {
+	for {
+		o.mu.RLock()
+		token, renew, expiry := o.token, o.renew, o.expiry
+		failure, retry := o.failure, o.retry
+		o.mu.RUnlock()
+
+		now := o.now()
+		backoff := failure != nil && now.Before(retry)
+		if token != "" && (expiry.IsZero() || now.Before(expiry)) {
+			if !renew.IsZero() && !now.Before(renew) && !backoff {
+				o.refresh()
+			}
+			req.Header.Set("Authorization", token)
+			return nil
+		}
+		if backoff {
+			return failure
+		}
+		<-o.refresh()
+	}
+}
+
+// Stats returns the TokenStats of the token fetches so far
+func (o *OAuth2) Stats() TokenStats {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.stats
+}
+
+// refresh starts fetching a new token, unless one is being fetched already,
+// and returns a channel closed once the fetch is over
+func (o *OAuth2) refresh() <-chan struct{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.fetching != nil {
+		return o.fetching
+	}
+	done := make(chan struct{})
+	o.fetching = done
+
+	go func() {
+		began := o.now()
+		token, lifetime, err := o.fetch()
+		latency := o.now().Sub(began)
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		defer close(done)
+		o.fetching = nil
+		o.stats.Fetches++
+		o.stats.Total += latency
+		if latency > o.stats.Max {
+			o.stats.Max = latency
+		}
+		if err != nil {
+			o.stats.Failures++
+			o.stats.LastError = err.Error()
+			o.failure, o.retry = fmt.Errorf("OAuth2: %s", err), o.now().Add(tokenBackoff)
+			return
+		}
+
+		o.token, o.failure = token, nil
+		o.renew, o.expiry = time.Time{}, time.Time{}
+		if lifetime > 0 {
+			delta := lifetime / 10
+			if delta > maxExpiryDelta {
+				delta = maxExpiryDelta
+			}
+			o.expiry = began.Add(lifetime)
+			o.renew = o.expiry.Add(-delta)
+		}
+	}()
+	return done
+}
+
+// fetch gets a new token and its lifetime, zero if it doesn't expire, from
+// the token endpoint
+func (o *OAuth2) fetch() (string, time.Duration, error) {
+	req, err := http.NewRequest("POST", o.tokenURL, strings.NewReader(o.form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.secret))
+
+	r, err := o.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return "", 0, fmt.Errorf("token endpoint: %s", r.Status)
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.Unmarshal(body, &tok); err != nil {
+		return "", 0, err
+	}
+	if tok.AccessToken == "" {
+		return "", 0, fmt.Errorf("token endpoint: no access_token")
+	}
+
+	if tok.TokenType == "" || strings.EqualFold(tok.TokenType, "bearer") {
+		tok.TokenType = "Bearer"
+	}
+	return tok.TokenType + " " + tok.AccessToken, time.Duration(tok.ExpiresIn) * time.Second, nil
+}
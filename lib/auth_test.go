@@ -0,0 +1,136 @@
+package stress
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStaticAuth(t *testing.T) {
+	t.Parallel()
+
+	for auth, want := range map[Authenticator]string{
+		BasicAuth{"goku", "9001"}: "Basic Z29rdTo5MDAx",
+		BearerToken("lolcat"):     "Bearer lolcat",
+	} {
+		req, _ := http.NewRequest("GET", "http://lolcathost:9999/", nil)
+		if err := auth.Authenticate(req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != want {
+			t.Errorf("Wrong authorization. Want: %s, Got: %s", want, got)
+		}
+	}
+}
+
+func TestOAuth2(t *testing.T) {
+	t.Parallel()
+
+	var fetches uint64
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, secret, _ := r.BasicAuth()
+			if id != "client" || secret != "s3cr3t" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "a b" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			n := atomic.AddUint64(&fetches, 1)
+			fmt.Fprintf(w, `{"access_token": "token%d", "token_type": "bearer", "expires_in": 100}`, n)
+		}),
+	)
+
+	// Tokens are fetched in the background, out of the clock the test moves
+	var elapsed int64
+	now := func() time.Time { return time.Unix(0, atomic.LoadInt64(&elapsed)) }
+	auth := NewOAuth2(server.URL, "client", "s3cr3t", []string{"a", "b"})
+	auth.now = now
+
+	for _, c := range []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{0, "Bearer token1"},
+		{80 * time.Second, "Bearer token1"},
+		// Tokens are fetched again 10s before they expire, in the background
+		{11 * time.Second, "Bearer token1"},
+		// Expired tokens wait for the one being fetched
+		{10 * time.Second, "Bearer token2"},
+		{1 * time.Second, "Bearer token2"},
+	} {
+		atomic.AddInt64(&elapsed, int64(c.elapsed))
+		req, _ := http.NewRequest("GET", "http://lolcathost:9999/", nil)
+		if err := auth.Authenticate(req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != c.want {
+			t.Errorf("After %s: want: %s, got: %s", c.elapsed, c.want, got)
+		}
+	}
+	if stats := auth.Stats(); stats.Fetches != 2 || stats.Failures != 0 {
+		t.Errorf("Wrong token stats: %+v", stats)
+	}
+
+	// Concurrent requests share the token being fetched
+	shared := NewOAuth2(server.URL, "client", "s3cr3t", []string{"a", "b"})
+	shared.now = now
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "http://lolcathost:9999/", nil)
+			if err := shared.Authenticate(req); err != nil || req.Header.Get("Authorization") == "" {
+				t.Errorf("Concurrent requests should be authenticated: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if stats := shared.Stats(); stats.Fetches != 1 {
+		t.Errorf("Wrong token stats: %+v", stats)
+	}
+
+	bad := NewOAuth2(server.URL, "client", "nope", nil)
+	bad.now = now
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "http://lolcathost:9999/", nil)
+		if err := bad.Authenticate(req); err == nil || req.Header.Get("Authorization") != "" {
+			t.Errorf("Failed token fetches should fail the request: %v", err)
+		}
+	}
+	// Failures are not fetched again before the backoff is over
+	if stats := bad.Stats(); stats.Fetches != 1 || stats.Failures != 1 || stats.LastError == "" {
+		t.Errorf("Wrong token stats: %+v", stats)
+	}
+	atomic.AddInt64(&elapsed, int64(tokenBackoff))
+	req, _ := http.NewRequest("GET", "http://lolcathost:9999/", nil)
+	if err := bad.Authenticate(req); err == nil {
+		t.Error("Failed token fetches should fail the request")
+	}
+	if stats := bad.Stats(); stats.Fetches != 2 || stats.Failures != 2 {
+		t.Errorf("Wrong token stats: %+v", stats)
+	}
+}
+
+func TestAttackAuth(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer lolcat" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.SetAuth(BearerToken("lolcat"))
+	for _, result := range atk.AttackConcy(Targets{{Method: "GET", URL: server.URL}}, 2, 10) {
+		if result.Error != "" {
+			t.Fatal(result.Error)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package stress
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Breaker tells when to stop an attack early because the targets are
+// failing. Any of its conditions stops the attack: MaxErrors failed
+// requests in total, or a ratio of failed requests above ErrorRatio or a
+// 99th latency percentile above MaxP99 within the last Window, once it
+// holds at least MinSamples results. Requests fail like they do in
+// Metrics.Success. Zero conditions are not checked.
+type Breaker struct {
+	MaxErrors  uint64
+	ErrorRatio float64
+	MaxP99     time.Duration
+	Window     time.Duration
+	MinSamples int
+}
+
+// Breaker defaults
+const (
+	DefaultBreakerWindow     = 10 * time.Second
+	DefaultBreakerMinSamples = 20
+)
+
+// ParseBreaker parses a Breaker described like:
+//
+//	errors=N;ratio=R;p99=DURATION[;window=DURATION][;min=N]
+//
+// where any condition may be left out, ratio is a fraction like 0.5 or a
+// percentage like 50%, the window is 10s and holds 20 results at least by
+// default.
+func ParseBreaker(spec string) (*Breaker, error) {
+	b := &Breaker{Window: DefaultBreakerWindow, MinSamples: DefaultBreakerMinSamples}
+	for _, opt := range strings.Split(spec, ";") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("option `%s` is invalid", opt)
+		}
+		var err error
+		switch kv[0] {
+		case "errors":
+			b.MaxErrors, err = strconv.ParseUint(kv[1], 10, 64)
+		case "ratio":
+			b.ErrorRatio, err = parseRatio(kv[1])
+		case "p99":
+			b.MaxP99, err = time.ParseDuration(kv[1])
+		case "window":
+			b.Window, err = time.ParseDuration(kv[1])
+			if err == nil && b.Window <= 0 {
+				err = errors.New("not positive")
+			}
+		case "min":
+			b.MinSamples, err = strconv.Atoi(kv[1])
+		default:
+			return nil, fmt.Errorf("option `%s` is invalid", opt)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s `%s` is invalid", kv[0], kv[1])
+		}
+	}
+	return b, nil
+}
+
+// parseRatio parses a ratio between 0 and 1 like 0.05 or 5%
+func parseRatio(s string) (float64, error) {
+	div := 1.0
+	if strings.HasSuffix(s, "%") {
+		s, div = strings.TrimSuffix(s, "%"), 100
+	}
+	r, err := strconv.ParseFloat(s, 64)
+	if r /= div; err != nil || r < 0 || r > 1 {
+		return 0, fmt.Errorf("ratio `%s` is invalid", s)
+	}
+	return r, nil
+}
+
+// SetBreaker sets the Breaker stopping attacks early, nil disabling it.
+// The result which trips it tells why in its Stopped field.
+func (a *Attacker) SetBreaker(b *Breaker) { a.breaker = b }
+
+// breakerWindow checks the conditions of a Breaker against the results of
+// an attack as they come in
+type breakerWindow struct {
+	*Breaker
+	errors  uint64
+	samples []breakerSample
+	failed  int
+	checked time.Time
+}
+
+type breakerSample struct {
+	at      time.Time
+	failed  bool
+	latency time.Duration
+}
+
+// p99Interval bounds how often the latency percentile of the window is
+// computed
+const p99Interval = 250 * time.Millisecond
+
+// add adds the result res collected at now and returns why the attack must
+// stop, if it must
+func (w *breakerWindow) add(res Result, now time.Time) string {
+	failed := !res.Success()
+	if failed {
+		w.errors++
+	}
+	if w.MaxErrors > 0 && w.errors >= w.MaxErrors {
+		return fmt.Sprintf("%d errors reached the limit of %d", w.errors, w.MaxErrors)
+	}
+	if w.ErrorRatio == 0 && w.MaxP99 == 0 {
+		return ""
+	}
+
+	w.samples = append(w.samples, breakerSample{now, failed, res.Latency})
+	if failed {
+		w.failed++
+	}
+	i := 0
+	for ; i < len(w.samples) && now.Sub(w.samples[i].at) > w.Window; i++ {
+		if w.samples[i].failed {
+			w.failed--
+		}
+	}
+	w.samples = w.samples[i:]
+	if len(w.samples) < w.MinSamples {
+		return ""
+	}
+
+	if ratio := float64(w.failed) / float64(len(w.samples)); w.ErrorRatio > 0 && ratio > w.ErrorRatio {
+		return fmt.Sprintf("error ratio %.2f%% over %s exceeds %.2f%%", ratio*100, w.Window, w.ErrorRatio*100)
+	}
+	if w.MaxP99 > 0 && now.Sub(w.checked) >= p99Interval {
+		w.checked = now
+		latencies := make([]time.Duration, len(w.samples))
+		for i, s := range w.samples {
+			latencies[i] = s.latency
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		if p99 := latencies[(len(latencies)*99-1)/100]; p99 > w.MaxP99 {
+			return fmt.Sprintf("99th latency percentile %s over %s exceeds %s", p99, w.Window, w.MaxP99)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package stress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseBreaker(t *testing.T) {
+	t.Parallel()
+
+	b, err := ParseBreaker("errors=100;ratio=5%;p99=2s;min=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Breaker{MaxErrors: 100, ErrorRatio: 0.05, MaxP99: 2 * time.Second, Window: DefaultBreakerWindow, MinSamples: 50}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("Want: %+v, Got: %+v", want, b)
+	}
+
+	for _, spec := range []string{"", "errors=-1", "ratio=2", "p99=slow", "window=0s", "lolcat=1"} {
+		if _, err := ParseBreaker(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestBreakerWindow(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 0)
+	ok, failed, slow := Result{Code: 200}, Result{Code: 500}, Result{Code: 200, Latency: time.Second}
+
+	for _, c := range []struct {
+		breaker Breaker
+		results []Result
+		want    string
+	}{
+		{Breaker{MaxErrors: 3}, []Result{failed, ok, failed, ok, failed}, "3 errors reached the limit of 3"},
+		{Breaker{ErrorRatio: 0.5, Window: time.Second, MinSamples: 4}, []Result{failed, failed, failed, ok}, "error ratio 75.00% over 1s exceeds 50.00%"},
+		{Breaker{ErrorRatio: 0.5, Window: time.Second, MinSamples: 4}, []Result{failed, failed, ok, ok, ok}, ""},
+		{Breaker{MaxP99: 500 * time.Millisecond, Window: time.Second, MinSamples: 2}, []Result{ok, slow}, "99th latency percentile 1s over 1s exceeds 500ms"},
+	} {
+		w := &breakerWindow{Breaker: &c.breaker}
+		got := ""
+		for _, res := range c.results {
+			if got = w.add(res, now); got != "" {
+				break
+			}
+		}
+		if got != c.want {
+			t.Errorf("%+v: want: %q, got: %q", c.breaker, c.want, got)
+		}
+	}
+
+	// Results older than the window are forgotten
+	w := &breakerWindow{Breaker: &Breaker{ErrorRatio: 0.5, Window: time.Second, MinSamples: 2}}
+	w.add(failed, now)
+	w.add(failed, now.Add(2*time.Second))
+	if got := w.add(ok, now.Add(2*time.Second)); got != "" {
+		t.Errorf("Expected the window to slide, got: %s", got)
+	}
+}
+
+func TestAttackBreaker(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.SetBreaker(&Breaker{MaxErrors: 10})
+	results := atk.AttackRate(Targets{{Method: "GET", URL: server.URL}}, 100, 10*time.Second)
+
+	if len(results) >= 1000 {
+		t.Fatalf("Expected the attack to stop early, Got: %d results", len(results))
+	}
+	m := NewMetrics(results)
+	if !strings.Contains(m.Stopped, "10 errors") {
+		t.Errorf("Wrong stop reason: %q", m.Stopped)
+	}
+}
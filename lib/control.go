@@ -0,0 +1,151 @@
+package stress
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStopped is why an attack stopped with Stop stopped
+var ErrStopped = errors.New("stopped on demand")
+
+// Pause pauses the attack the Attacker is running, which sends no request
+// until it is resumed. Requests in flight still come back. The time spent
+// paused doesn't count in the duration of attacks in rate mode.
+func (a *Attacker) Pause() {
+	if at := a.current(); at != nil {
+		at.pause(time.Now())
+	}
+}
+
+// Resume resumes the attack the Attacker is running once paused
+func (a *Attacker) Resume() {
+	if at := a.current(); at != nil {
+		at.resume(time.Now())
+	}
+}
+
+// Paused reports whether the attack the Attacker is running is paused
+func (a *Attacker) Paused() bool {
+	at := a.current()
+	return at != nil && at.isPaused()
+}
+
+// AdjustRate changes the rate of the attack the Attacker is running in rate
+// mode, which keeps its duration: it sends as many requests as its new rate
+// allows in the time it has left. Attacks in concurrency mode ignore it.
+func (a *Attacker) AdjustRate(rate uint64) {
+	at := a.current()
+	if at == nil || at.duration == 0 || rate == 0 {
+		return
+	}
+	at.adjust(rate)
+}
+
+// Stop stops the attack the Attacker is running early with ErrStopped, the
+// requests in flight still coming back. The Stopped field of a result of
+// the attack tells so.
+func (a *Attacker) Stop() {
+	if at := a.current(); at != nil {
+		at.stop(ErrStopped)
+	}
+}
+
+// run sets the attack the Attacker is running, nil once it is done
+func (a *Attacker) run(at *attack) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running = at
+}
+
+func (a *Attacker) current() *attack {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.running
+}
+
+// control holds whether an attack is paused, for how long it was paused
+// and the rates it was adjusted to
+type control struct {
+	mu        sync.Mutex
+	resumec   chan struct{}
+	pausedAt  time.Time
+	pausedFor time.Duration
+	ratec     chan uint64
+}
+
+func (at *attack) pause(now time.Time) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	if at.resumec == nil {
+		at.resumec, at.pausedAt = make(chan struct{}), now
+	}
+}
+
+func (at *attack) resume(now time.Time) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	if at.resumec != nil {
+		close(at.resumec)
+		at.resumec, at.pausedFor = nil, at.pausedFor+now.Sub(at.pausedAt)
+	}
+}
+
+// adjust hands rate to the attack in place of the one it didn't take yet,
+// without waiting for it to take it
+func (at *attack) adjust(rate uint64) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	// Only the last rate matters
+	select {
+	case <-at.ratec:
+	default:
+	}
+	select {
+	case at.ratec <- rate:
+	default:
+	}
+}
+
+func (at *attack) isPaused() bool {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	return at.resumec != nil
+}
+
+// wait waits while the attack is paused and reports whether it may go on,
+// which it may not once stopped
+func (at *attack) wait() bool {
+	at.mu.Lock()
+	resumec := at.resumec
+	at.mu.Unlock()
+	if resumec != nil {
+		select {
+		case <-resumec:
+		case <-at.stopc:
+		}
+	}
+	return !at.stopped()
+}
+
+// active returns how long the attack ran until now, pauses left out
+func (at *attack) active(now time.Time) time.Duration {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+	d := now.Sub(at.start) - at.pausedFor
+	if at.resumec != nil {
+		d -= now.Sub(at.pausedAt)
+	}
+	return d
+}
+
+// replan plans the requests of the attack anew at rate once sent of them
+// are sent, so that it lasts as long as planned
+func (at *attack) replan(sent int, rate uint64) {
+	left := at.duration - at.active(time.Now())
+	if left < 0 {
+		left = 0
+	}
+	atomic.StoreInt64(&at.total, int64(sent)+int64(float64(rate)*left.Seconds()))
+}
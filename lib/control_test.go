@@ -0,0 +1,130 @@
+package stress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	t.Parallel()
+
+	var hits int64
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&hits, 1)
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	done := make(chan Results)
+	go func() { done <- atk.AttackRate(Targets{{Method: "GET", URL: server.URL}}, 100, 1*time.Second) }()
+
+	time.Sleep(300 * time.Millisecond)
+	atk.Pause()
+	if !atk.Paused() {
+		t.Fatal("Attack not paused")
+	}
+	time.Sleep(50 * time.Millisecond)
+	paused := atomic.LoadInt64(&hits)
+	time.Sleep(500 * time.Millisecond)
+	if n := atomic.LoadInt64(&hits); n != paused {
+		t.Errorf("Requests sent while paused: %d", n-paused)
+	}
+	atk.Resume()
+
+	// The time paused doesn't count in the duration
+	start := time.Now()
+	results := <-done
+	if len(results) != 100 {
+		t.Errorf("Wrong number of results. Want: 100, Got: %d", len(results))
+	}
+	if d := time.Since(start); d < 500*time.Millisecond {
+		t.Errorf("Attack resumed for %s only", d)
+	}
+	if atk.Paused() {
+		t.Error("Attack paused once done")
+	}
+}
+
+func TestAdjustRate(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	done := make(chan Results)
+	start := time.Now()
+	go func() { done <- atk.AttackRate(Targets{{Method: "GET", URL: server.URL}}, 50, 2*time.Second) }()
+
+	// 50 requests in the first second, 200 in the second one
+	time.Sleep(1 * time.Second)
+	atk.AdjustRate(200)
+	results := <-done
+	if n := len(results); n < 200 || n > 280 {
+		t.Errorf("Wrong number of results. Want: about 250, Got: %d", n)
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Errorf("Attack lasted %s instead of 2s", d)
+	}
+}
+
+func TestAdjustUntaken(t *testing.T) {
+	t.Parallel()
+
+	// Rates nobody takes neither block nor pile up
+	at := newAttack(0, time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(rate uint64) {
+			defer wg.Done()
+			at.adjust(rate)
+		}(uint64(i + 1))
+	}
+	wg.Wait()
+	at.adjust(42)
+	if rate := <-at.ratec; rate != 42 {
+		t.Errorf("Wrong rate. Want: 42, Got: %d", rate)
+	}
+}
+
+func TestStop(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(10 * time.Millisecond)
+		}),
+	)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	// Controls are ignored outside of attacks
+	atk.Stop()
+	atk.Pause()
+
+	done := make(chan Results)
+	go func() { done <- atk.AttackConcy(Targets{{Method: "GET", URL: server.URL}}, 2, 1000) }()
+	time.Sleep(100 * time.Millisecond)
+	atk.Pause()
+	atk.Stop()
+	results := <-done
+	if len(results) == 0 || len(results) >= 1000 {
+		t.Errorf("Wrong number of results: %d", len(results))
+	}
+	// A single result tells the attack was stopped
+	stopped := 0
+	for _, res := range results {
+		if res.Stopped == ErrStopped.Error() {
+			stopped++
+		}
+	}
+	if stopped != 1 || NewMetrics(results).Stopped != ErrStopped.Error() {
+		t.Errorf("Wrong stopped results: %d", stopped)
+	}
+}
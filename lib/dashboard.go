@@ -0,0 +1,266 @@
+package stress
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebDashboard is an http.Handler serving a live dashboard of the attacks
+// of an Attacker: charts of the latency percentiles and throughput of every
+// interval, the metrics of the attack so far, its status codes and top
+// errors. It is fed with Update, which can be handed to SetProgress, and
+// pushes every Progress to the browsers over server-sent events. Its page
+// works offline.
+type WebDashboard struct {
+	mu      sync.Mutex
+	events  [][]byte
+	clients map[chan []byte]struct{}
+	results uint64
+}
+
+// webDashboardHistory bounds the events a WebDashboard replays to the
+// browsers connecting
+const webDashboardHistory = 3600
+
+// NewWebDashboard returns a new WebDashboard, without any Progress
+func NewWebDashboard() *WebDashboard {
+	return &WebDashboard{clients: map[chan []byte]struct{}{}}
+}
+
+// webEvent is the event a Progress is pushed to the browsers as, with
+// durations in milliseconds or seconds. Results counts the results of the
+// interval, P50 and P99 being nil when there are none.
+type webEvent struct {
+	Elapsed    float64      `json:"elapsed"`
+	Remaining  float64      `json:"remaining"`
+	Requests   uint64       `json:"requests"`
+	Total      uint64       `json:"total"`
+	Rate       float64      `json:"rate"`
+	InFlight   uint64       `json:"in_flight"`
+	Results    uint64       `json:"results"`
+	Throughput float64      `json:"throughput"`
+	Success    float64      `json:"success"`
+	P50        *float64     `json:"p50"`
+	P99        *float64     `json:"p99"`
+	Errors     uint64       `json:"errors"`
+	Paused     bool         `json:"paused"`
+	Done       bool         `json:"done"`
+	Metrics    *Metrics     `json:"metrics"`
+	TopErrors  []ErrorCount `json:"top_errors"`
+}
+
+// Update pushes the Progress p to the browsers
+func (d *WebDashboard) Update(p Progress) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Results start over with every attack
+	if p.Results < d.results {
+		d.results = 0
+	}
+	ev := webEvent{
+		Elapsed:   p.Elapsed.Seconds(),
+		Remaining: p.Remaining.Seconds(),
+		Requests:  p.Requests,
+		Total:     p.Total,
+		Rate:      p.Rate,
+		InFlight:  p.InFlight,
+		Results:   p.Results - d.results,
+		Success:   p.Success,
+		Errors:    p.Errors,
+		Paused:    p.Paused,
+		Done:      p.Done,
+		Metrics:   p.Metrics,
+		TopErrors: TopErrors(p.ErrorCounts, 10),
+	}
+	d.results = p.Results
+	if secs := p.Interval.Seconds(); secs > 0 {
+		ev.Throughput = float64(ev.Results) / secs
+	}
+	if ev.Results > 0 {
+		p50, p99 := millis(p.P50), millis(p.P99)
+		ev.P50, ev.P99 = &p50, &p99
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	d.events = append(d.events, data)
+	if len(d.events) > webDashboardHistory {
+		d.events = d.events[1:]
+	}
+	// Slow browsers miss events rather than holding up the attack
+	for c := range d.clients {
+		select {
+		case c <- data:
+		default:
+		}
+	}
+}
+
+func millis(d time.Duration) float64 { return d.Seconds() * 1000 }
+
+// ServeHTTP serves the page of the dashboard on /, its events on /events
+// and the dygraph library it draws its charts with on /dygraph.js
+func (d *WebDashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(webDashboardPage))
+	case "/dygraph.js":
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write(dygraphJS())
+	case "/events":
+		d.serveEvents(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveEvents replays the past events and then streams the new ones until
+// the browser goes away
+func (d *WebDashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	c := make(chan []byte, 64)
+	d.mu.Lock()
+	for _, data := range d.events {
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	d.clients[c] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, c)
+		d.mu.Unlock()
+	}()
+	flusher.Flush()
+
+	for {
+		select {
+		case data := <-c:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+var (
+	dygraphOnce sync.Once
+	dygraphSrc  []byte
+)
+
+// dygraphJS returns the dygraph library, decompressed once
+func dygraphJS() []byte {
+	dygraphOnce.Do(func() { dygraphSrc = dygraphJSLibSrc() })
+	return dygraphSrc
+}
+
+const webDashboardPage = `<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Stress Live</title>
+  <script src="dygraph.js"></script>
+  <style>
+    body { font-family: Courier; margin: 20px; }
+    .chart { width: 100%; height: 300px; margin-bottom: 20px; }
+    table { border-collapse: collapse; margin-bottom: 20px; }
+    td, th { padding: 2px 12px 2px 0; text-align: left; }
+  </style>
+</head>
+<body>
+  <h2>Stress Live <span id="state">connecting</span></h2>
+  <table>
+    <tr><th>Elapsed</th><td id="elapsed"></td><th>Remaining</th><td id="remaining"></td></tr>
+    <tr><th>Requests</th><td id="requests"></td><th>Rate</th><td id="rate"></td></tr>
+    <tr><th>In flight</th><td id="in-flight"></td><th>Success</th><td id="success"></td></tr>
+    <tr><th>Latencies</th><td id="latencies" colspan="3"></td></tr>
+  </table>
+  <div id="latency" class="chart"></div>
+  <div id="throughput" class="chart"></div>
+  <h3>Status codes</h3>
+  <table id="codes"></table>
+  <h3>Top errors</h3>
+  <table id="errors"></table>
+  <script>
+  var latency = [], throughput = [], charts = null;
+
+  function ms(ns) { return (ns / 1e6).toFixed(2) + "ms"; }
+  function text(id, value) { document.getElementById(id).textContent = value; }
+  function rows(id, cells) {
+    var table = document.getElementById(id);
+    table.innerHTML = "";
+    cells.forEach(function(cell) {
+      var tr = table.insertRow();
+      tr.insertCell().textContent = cell[0];
+      tr.insertCell().textContent = cell[1];
+    });
+  }
+
+  var events = new EventSource("events");
+  // Past events are replayed on every connection
+  events.onopen = function() {
+    latency = [];
+    throughput = [];
+  };
+  events.onmessage = function(e) {
+    var ev = JSON.parse(e.data), m = ev.metrics;
+    if (!ev.done) {
+      latency.push([ev.elapsed, ev.p50, ev.p99]);
+      throughput.push([ev.elapsed, ev.throughput, ev.errors]);
+    }
+    if (!charts && latency.length > 0) {
+      charts = [
+        new Dygraph(document.getElementById("latency"), latency, {
+          title: "Latency", labels: ["Seconds", "p50", "p99"], ylabel: "Latency (ms)",
+          xlabel: "Seconds elapsed", colors: ["#8AE234", "#FA7878"], legend: "always",
+          connectSeparatedPoints: false, strokeWidth: 1.3
+        }),
+        new Dygraph(document.getElementById("throughput"), throughput, {
+          title: "Throughput", labels: ["Seconds", "Results/s", "Errors"], ylabel: "Results per second",
+          xlabel: "Seconds elapsed", colors: ["#729FCF", "#FA7878"], legend: "always", strokeWidth: 1.3
+        })
+      ];
+    } else if (charts) {
+      charts[0].updateOptions({file: latency});
+      charts[1].updateOptions({file: throughput});
+    }
+
+    text("state", ev.done ? "done" : ev.paused ? "paused" : "running");
+    text("elapsed", ev.elapsed.toFixed(0) + "s");
+    text("remaining", ev.remaining.toFixed(0) + "s");
+    text("requests", ev.requests + " / " + ev.total);
+    text("rate", ev.rate.toFixed(2) + "/s");
+    text("in-flight", ev.in_flight);
+    text("success", (m.success * 100).toFixed(2) + "%");
+    text("latencies", "mean " + ms(m.latencies.mean) + ", 50 " + ms(m.latencies["50th"]) +
+      ", 95 " + ms(m.latencies["95th"]) + ", 99 " + ms(m.latencies["99th"]) + ", max " + ms(m.latencies.max));
+    rows("codes", Object.keys(m.status_codes).sort().map(function(code) {
+      return [code, m.status_codes[code]];
+    }));
+    rows("errors", (ev.top_errors || []).map(function(e) { return [e.count, e.error]; }));
+    if (ev.done) {
+      events.close();
+    }
+  };
+  events.onerror = function() {
+    text("state", "disconnected");
+  };
+  </script>
+</body>
+</html>`
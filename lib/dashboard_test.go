@@ -0,0 +1,72 @@
+package stress
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebDashboard(t *testing.T) {
+	t.Parallel()
+
+	d := NewWebDashboard()
+	server := httptest.NewServer(d)
+	defer server.Close()
+
+	for path, want := range map[string]string{"/": "EventSource", "/dygraph.js": "Dygraph"} {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != 200 || !strings.Contains(string(body), want) {
+			t.Errorf("%s: wrong response %d without %s", path, res.StatusCode, want)
+		}
+	}
+
+	g := NewAggregator()
+	g.Add(Result{Code: 200, Latency: 2 * time.Millisecond})
+	progress := Progress{Elapsed: time.Second, Interval: time.Second, Results: 1,
+		Success: 1, P50: 2 * time.Millisecond, P99: 2 * time.Millisecond, Metrics: g.Metrics()}
+	d.Update(progress)
+
+	res, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Wrong content type: %s", ct)
+	}
+	events := bufio.NewReader(res.Body)
+	next := func() (ev webEvent) {
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				if err = json.Unmarshal([]byte(line[6:]), &ev); err != nil {
+					t.Fatal(err)
+				}
+				return ev
+			}
+		}
+	}
+
+	// Past events are replayed, new ones streamed
+	if ev := next(); ev.Throughput != 1 || ev.P99 == nil || *ev.P99 != 2 || ev.Metrics.Requests != 1 {
+		t.Errorf("Wrong replayed event: %+v", ev)
+	}
+	progress.Elapsed, progress.Done = 2*time.Second, true
+	d.Update(progress)
+	if ev := next(); !ev.Done || ev.Elapsed != 2 || ev.Results != 0 || ev.P99 != nil {
+		t.Errorf("Wrong streamed event: %+v", ev)
+	}
+}
@@ -0,0 +1,185 @@
+package stress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec decodes and encodes the bodies of a content encoding. Either
+// function may be nil when the encoding is only decoded or encoded.
+type Codec struct {
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		"gzip": {
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		},
+		"deflate": {
+			NewReader: zlib.NewReader,
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil },
+		},
+		"zstd": {
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				d, err := zstd.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				return d.IOReadCloser(), nil
+			},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+		},
+	}
+)
+
+// RegisterCodec registers the Codec of a content encoding. gzip, deflate and
+// zstd are built in, others like br can be registered out of third party
+// packages, e.g. github.com/andybalholm/brotli.
+func RegisterCodec(encoding string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(encoding)] = c
+}
+
+// Codecs returns the content encodings with a registered Codec
+func Codecs() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	encodings := make([]string, 0, len(codecs))
+	for enc := range codecs {
+		encodings = append(encodings, enc)
+	}
+	sort.Strings(encodings)
+	return encodings
+}
+
+func codec(encoding string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[strings.ToLower(strings.TrimSpace(encoding))]
+	return c, ok
+}
+
+// encoder returns the Codec of a content encoding request bodies can be
+// compressed with
+func encoder(encoding string) (Codec, error) {
+	if c, ok := codec(encoding); ok && c.NewWriter != nil {
+		return c, nil
+	}
+	return Codec{}, fmt.Errorf("content encoding `%s` is not supported, use one of %s",
+		encoding, strings.Join(Codecs(), ", "))
+}
+
+// Compress sets the ContentEncoding of the Targets which have none
+func (t Targets) Compress(encoding string) error {
+	if _, err := encoder(encoding); err != nil {
+		return err
+	}
+	for i := range t {
+		if t[i].ContentEncoding == "" {
+			t[i].ContentEncoding = encoding
+		}
+	}
+	return nil
+}
+
+// encodeBody compresses the body of req, which is then sent chunked
+func encodeBody(req *http.Request, encoding string) error {
+	c, err := encoder(encoding)
+	if err != nil {
+		return err
+	}
+	if req.Body, err = newEncodingReader(req.Body, c); err != nil {
+		return err
+	}
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newEncodingReader(body, c)
+		}
+	}
+	req.ContentLength = -1
+	req.Header.Set("Content-Encoding", encoding)
+	return nil
+}
+
+// encodingReader reads the encoding of src as it reads it, without
+// buffering more than a chunk of it
+type encodingReader struct {
+	src   io.ReadCloser
+	enc   io.WriteCloser
+	buf   bytes.Buffer
+	chunk []byte
+	eof   bool
+}
+
+func newEncodingReader(src io.ReadCloser, c Codec) (io.ReadCloser, error) {
+	r := &encodingReader{src: src, chunk: make([]byte, 32<<10)}
+	var err error
+	if r.enc, err = c.NewWriter(&r.buf); err != nil {
+		src.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *encodingReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && !r.eof {
+		n, err := r.src.Read(r.chunk)
+		if _, werr := r.enc.Write(r.chunk[:n]); werr != nil {
+			return 0, werr
+		}
+		if err == io.EOF {
+			r.eof = true
+			if err = r.enc.Close(); err != nil {
+				return 0, err
+			}
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if r.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return r.buf.Read(p)
+}
+
+func (r *encodingReader) Close() error { return r.src.Close() }
+
+// decodeBody returns body decoded out of its content encoding, and whether
+// it was decoded: bodies without a Codec decoding them are returned as is
+func decodeBody(body []byte, encoding string) ([]byte, bool, error) {
+	c, ok := codec(encoding)
+	if encoding == "" || !ok || c.NewReader == nil {
+		return body, false, nil
+	}
+	r, err := c.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+	decoded, err := ioutil.ReadAll(r)
+	return decoded, err == nil, err
+}
+
+// SetAcceptEncoding sets the Accept-Encoding header of the requests which
+// don't set their own, gzip by default. Responses are decoded when a Codec
+// of their encoding is registered, an empty value not asking for any.
+func (a *Attacker) SetAcceptEncoding(encoding string) { a.acceptEncoding = encoding }
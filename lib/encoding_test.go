@@ -0,0 +1,161 @@
+package stress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestResponseEncoding(t *testing.T) {
+	t.Parallel()
+
+	text := strings.Repeat("lolcat", 1000)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Header.Get("Accept-Encoding") {
+			case "gzip":
+				w.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(w)
+				gz.Write([]byte(text))
+				gz.Close()
+			case "zstd":
+				w.Header().Set("Content-Encoding", "zstd")
+				zw, _ := zstd.NewWriter(w)
+				zw.Write([]byte(text))
+				zw.Close()
+			case "br":
+				w.Header().Set("Content-Encoding", "br")
+				w.Write([]byte("not really brotli"))
+			default:
+				w.Write([]byte(text))
+			}
+		}),
+	)
+	tgt := Target{Method: "GET", URL: server.URL, Expect: Expect{Contains: "catlol"}}
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	res := atk.AttackConcy(Targets{tgt}, 1, 1)[0]
+	if res.Code != 200 || res.Encoding != "gzip" || res.BytesIn != uint64(len(text)) || res.BytesInEncoded >= res.BytesIn {
+		t.Errorf("Wrong gzip result: %+v", res)
+	}
+
+	atk.SetAcceptEncoding("zstd")
+	res = atk.AttackConcy(Targets{tgt}, 1, 1)[0]
+	if res.Code != 200 || res.Encoding != "zstd" || res.BytesIn != uint64(len(text)) || res.BytesInEncoded >= res.BytesIn {
+		t.Errorf("Wrong zstd result: %+v", res)
+	}
+
+	// Encodings without a Codec are left as is
+	atk.SetAcceptEncoding("br")
+	res = atk.AttackConcy(Targets{{Method: "GET", URL: server.URL}}, 1, 1)[0]
+	if res.Code != 200 || res.Encoding != "br" || res.BytesIn != 17 || res.BytesInEncoded != 17 {
+		t.Errorf("Wrong br result: %+v", res)
+	}
+
+	atk.SetAcceptEncoding("")
+	res = atk.AttackConcy(Targets{tgt}, 1, 1)[0]
+	if res.Code != 200 || res.Encoding != "" || res.BytesIn != uint64(len(text)) || res.BytesInEncoded != res.BytesIn {
+		t.Errorf("Wrong identity result: %+v", res)
+	}
+}
+
+func TestRequestEncoding(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil || r.Header.Get("Content-Encoding") != "gzip" || r.ContentLength != -1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(gz)
+			w.Write([]byte(strconv.Itoa(len(body))))
+		}),
+	)
+
+	targets, err := NewTargets([]string{
+		"PUT " + server.URL + " synth:1MB;repeat=lolcat encoding:gzip",
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = targets.Preload(DefaultBodyCache); err != nil {
+		t.Fatal(err)
+	}
+	targets[0].Expect.Contains = strconv.Itoa(1 << 20)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	res := atk.AttackConcy(targets, 1, 1)[0]
+	if res.Code != 200 || res.BytesOut == 0 || res.BytesOut >= 1<<20 {
+		t.Errorf("Wrong result: %+v", res)
+	}
+
+	// Rewound bodies are compressed the same
+	req, err := targets[0].Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := ioutil.ReadAll(req.Body)
+	body, err := req.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := ioutil.ReadAll(body)
+	if !bytes.Equal(first, again) {
+		t.Errorf("Rewound body differs: %d and %d bytes", len(first), len(again))
+	}
+
+	zstdTargets, err := NewTargets([]string{"PUT http://a/ body:lolcat encoding:zstd"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, err = zstdTargets[0].Request(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zstd.NewReader(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(zr); string(body) != "lolcat" {
+		t.Errorf("Wrong zstd body: %q", body)
+	}
+	zr.Close()
+
+	if _, err = NewTargets([]string{"PUT http://a/ body:a encoding:br"}, nil, nil); err == nil || !strings.Contains(err.Error(), "`br` is not supported") {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	t.Parallel()
+
+	// A codec upper casing bodies
+	RegisterCodec("x-upper", Codec{
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return upperWriter{w}, nil },
+	})
+	targets, err := NewTargets([]string{"PUT http://lolcathost:9999/ body:lolcat encoding:x-upper"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := targets[0].Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "LOLCAT" || req.Header.Get("Content-Encoding") != "x-upper" {
+		t.Errorf("Wrong encoded body: %s", body)
+	}
+}
+
+type upperWriter struct{ io.Writer }
+
+func (w upperWriter) Write(p []byte) (int, error) { return w.Writer.Write(bytes.ToUpper(p)) }
+func (w upperWriter) Close() error                { return nil }
@@ -0,0 +1,152 @@
+package stress
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrFeederExhausted is returned by a Feeder which doesn't recycle its rows
+// once every row has been used. It ends the attack.
+var ErrFeederExhausted = errors.New("Feeder: out of data")
+
+// Feeder ordering modes
+const (
+	// FeedSequential hands out rows in the order they were read
+	FeedSequential = "sequential"
+	// FeedRandom hands out a randomly picked row on every call
+	FeedRandom = "random"
+	// FeedUnique hands out every row once in random order
+	FeedUnique = "unique"
+)
+
+// Feeder hands out rows of data which parameterize the requests built out
+// of Targets. Each column of a row is available to target templates as
+// {{.Data.column}}. A Feeder is safe for concurrent use.
+type Feeder struct {
+	rows    []map[string]string
+	mode    string
+	recycle bool
+
+	mu    sync.Mutex
+	next  int
+	order []int
+	rnd   *rand.Rand
+}
+
+// NewFeeder returns a Feeder handing out the passed rows in the specified
+// mode. With recycle a sequential or unique Feeder starts over once all its
+// rows have been used, otherwise it returns ErrFeederExhausted.
+func NewFeeder(rows []map[string]string, mode string, recycle bool) (*Feeder, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("Feeder: no rows")
+	}
+
+	f := &Feeder{
+		rows:    rows,
+		mode:    mode,
+		recycle: recycle,
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	switch mode {
+	case FeedSequential, FeedRandom:
+	case FeedUnique:
+		f.order = f.rnd.Perm(len(rows))
+	default:
+		return nil, fmt.Errorf("Feeder: mode `%s` is invalid", mode)
+	}
+	return f, nil
+}
+
+// NewCSVFeeder reads the rows of a Feeder from CSV data whose first record
+// holds the column names.
+func NewCSVFeeder(source io.Reader, mode string, recycle bool) (*Feeder, error) {
+	r := csv.NewReader(source)
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("Feeder: no rows")
+	}
+
+	columns := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return NewFeeder(rows, mode, recycle)
+}
+
+// NewJSONFeeder reads the rows of a Feeder from line separated JSON objects.
+// String values are used as they are and any other value as its JSON text.
+func NewJSONFeeder(source io.Reader, mode string, recycle bool) (*Feeder, error) {
+	dec := json.NewDecoder(source)
+	dec.UseNumber()
+
+	var rows []map[string]string
+	for line := 1; ; line++ {
+		var obj map[string]json.RawMessage
+		if err := dec.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Feeder: row %d: %s", line, err)
+		}
+
+		row := make(map[string]string, len(obj))
+		for k, v := range obj {
+			var s string
+			if err := json.Unmarshal(v, &s); err == nil {
+				row[k] = s
+			} else {
+				row[k] = string(bytes.TrimSpace(v))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return NewFeeder(rows, mode, recycle)
+}
+
+// Next returns the next row of the Feeder or ErrFeederExhausted.
+func (f *Feeder) Next() (map[string]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.mode == FeedRandom {
+		return f.rows[f.rnd.Intn(len(f.rows))], nil
+	}
+
+	if f.next == len(f.rows) {
+		if !f.recycle {
+			return nil, ErrFeederExhausted
+		}
+		f.next = 0
+		if f.mode == FeedUnique {
+			f.order = f.rnd.Perm(len(f.rows))
+		}
+	}
+
+	i := f.next
+	f.next++
+	if f.mode == FeedUnique {
+		i = f.order[i]
+	}
+	return f.rows[i], nil
+}
+
+// Len returns the number of rows of the Feeder
+func (f *Feeder) Len() int {
+	return len(f.rows)
+}
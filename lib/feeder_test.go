@@ -0,0 +1,114 @@
+package stress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVFeeder(t *testing.T) {
+	t.Parallel()
+
+	src := "id,key\n1,a\n2,b\n3,c\n"
+	f, err := NewCSVFeeder(strings.NewReader(src), FeedSequential, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		row, err := f.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := row["key"]; got != want {
+			t.Fatalf("Wrong row. Want: %s, Got: %s", want, got)
+		}
+	}
+	if _, err := f.Next(); err != ErrFeederExhausted {
+		t.Fatalf("Expected error to be: %s, Got: %v", ErrFeederExhausted, err)
+	}
+
+	f, err = NewCSVFeeder(strings.NewReader(src), FeedSequential, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := f.Next(); err != nil {
+			t.Fatalf("Recycling feeder shouldn't run out of rows: %s", err)
+		}
+	}
+
+	if _, err := NewCSVFeeder(strings.NewReader("id\n"), FeedRandom, false); err == nil {
+		t.Error("Feeder without rows shouldn't be valid")
+	}
+	if _, err := NewCSVFeeder(strings.NewReader(src), "lolcat", false); err == nil {
+		t.Error("Feeder mode `lolcat` shouldn't be valid")
+	}
+}
+
+func TestUniqueFeeder(t *testing.T) {
+	t.Parallel()
+
+	src := `{"id": 1, "name": "a"}
+{"id": 2, "name": "b", "tags": ["x"]}
+{"id": 3, "name": "c"}`
+	f, err := NewJSONFeeder(strings.NewReader(src), FeedUnique, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < f.Len(); i++ {
+		row, err := f.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[row["id"]] {
+			t.Fatalf("Row %s was handed out twice", row["id"])
+		}
+		seen[row["id"]] = true
+		if row["id"] == "2" && row["tags"] != `["x"]` {
+			t.Errorf("Wrong JSON value. Want: %s, Got: %s", `["x"]`, row["tags"])
+		}
+	}
+	if _, err := f.Next(); err != ErrFeederExhausted {
+		t.Fatalf("Expected error to be: %s, Got: %v", ErrFeederExhausted, err)
+	}
+}
+
+func TestFeederAttack(t *testing.T) {
+	t.Parallel()
+
+	paths := make(chan string, 10)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths <- r.URL.Path
+		}),
+	)
+
+	f, err := NewCSVFeeder(strings.NewReader("user\nalice\nbob\n"), FeedSequential, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := NewTargets([]string{"GET " + server.URL + "/users/{{.Data.user}}"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets.Feed(f)
+
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	results := atk.AttackRate(targets, 100, 1*time.Second)
+	if len(results) != 2 {
+		t.Fatalf("Attack should stop once the feeder runs out. Got %d results", len(results))
+	}
+
+	close(paths)
+	got := map[string]bool{}
+	for path := range paths {
+		got[path] = true
+	}
+	if !got["/users/alice"] || !got["/users/bob"] {
+		t.Fatalf("Wrong requested paths: %v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package stress
+
+import (
+	"fmt"
+	"mime"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+)
+
+// FormPart is a part of a multipart form request body: a text field or, when
+// File is set, the upload of a file.
+type FormPart struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+	File  string `json:"file,omitempty"`
+	// Synthetic uploads a generated file instead of File
+	Synthetic *Synthetic `json:"synthetic,omitempty"`
+	// Filename is the filename sent along with File, its base name by default
+	Filename string `json:"filename,omitempty"`
+	// ContentType of the part, guessed out of the extension of File by default
+	ContentType string `json:"type,omitempty"`
+}
+
+// parseFormPart parses the form part described by a form: directive. Parts
+// are described like curl does: name=value for text fields and
+// name=@file[;type=mime][;filename=name] for files, where file may be a
+// synth:spec of generated content. The legacy [filekey:]file syntax describes
+// a single file field named file by default.
+func parseFormPart(directive string) (FormPart, error) {
+	spec := strings.TrimPrefix(directive, "form:")
+	i := strings.IndexByte(spec, '=')
+	if i < 0 || strings.ContainsAny(spec[:i], ":/\\") {
+		kv := strings.Split(spec, ":")
+		part := FormPart{Name: "file", ContentType: "application/octet-stream"}
+		switch {
+		case len(kv) == 1 && kv[0] != "":
+			part.File = kv[0]
+		case len(kv) == 2 && kv[0] != "" && kv[1] != "":
+			part.Name, part.File = kv[0], kv[1]
+		default:
+			return FormPart{}, fmt.Errorf("Form file: "+"(%s): illegal", directive)
+		}
+		part.Filename = part.File
+		return part, nil
+	}
+
+	if i == 0 {
+		return FormPart{}, fmt.Errorf("form part `%s` has no name", spec)
+	}
+	part := FormPart{Name: spec[:i]}
+	value := spec[i+1:]
+	if !strings.HasPrefix(value, "@") {
+		part.Value = value
+		return part, nil
+	}
+
+	opts := strings.Split(value[1:], ";")
+	if part.File = opts[0]; part.File == "" {
+		return FormPart{}, fmt.Errorf("form part `%s` has no file", part.Name)
+	}
+	synth := strings.HasPrefix(part.File, "synth:")
+	synthSpec := []string{strings.TrimPrefix(part.File, "synth:")}
+	for _, opt := range opts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case len(kv) == 2 && kv[0] == "type" && kv[1] != "":
+			part.ContentType = kv[1]
+		case len(kv) == 2 && kv[0] == "filename" && kv[1] != "":
+			part.Filename = kv[1]
+		case synth:
+			// Other options are the ones of the synthetic content
+			synthSpec = append(synthSpec, opt)
+		default:
+			return FormPart{}, fmt.Errorf("invalid option `%s` of form part `%s`", opt, part.Name)
+		}
+	}
+	if synth {
+		var err error
+		if part.Synthetic, err = NewSynthetic(strings.Join(synthSpec, ";")); err != nil {
+			return FormPart{}, fmt.Errorf("form part `%s`: %s", part.Name, err)
+		}
+		part.File = ""
+	}
+	return part, nil
+}
+
+// formParts returns the form parts of the Target, including the one of a
+// legacy form: directive set as its File
+func (t *Target) formParts() ([]FormPart, error) {
+	if len(t.Form) > 0 {
+		return t.Form, nil
+	}
+	if t.Method == "POST" && strings.HasPrefix(t.File, "form:") {
+		part, err := parseFormPart(t.File)
+		if err != nil {
+			return nil, err
+		}
+		return []FormPart{part}, nil
+	}
+	return nil, nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// header returns the MIME header of the form part
+func (f *FormPart) header() textproto.MIMEHeader {
+	h := textproto.MIMEHeader{}
+	disposition := fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(f.Name))
+	ctype := f.ContentType
+	if f.File != "" || f.Synthetic != nil {
+		filename := f.Filename
+		if filename == "" && f.File != "" {
+			filename = filepath.Base(f.File)
+		} else if filename == "" {
+			filename = "synthetic"
+		}
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(filename))
+		if ctype == "" {
+			ctype = mime.TypeByExtension(filepath.Ext(f.File))
+		}
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+	}
+	h.Set("Content-Disposition", disposition)
+	if ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+	return h
+}
@@ -0,0 +1,127 @@
+package stress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFormPart(t *testing.T) {
+	t.Parallel()
+
+	for directive, want := range map[string]FormPart{
+		"form:a.jpg":        {Name: "file", File: "a.jpg", Filename: "a.jpg", ContentType: "application/octet-stream"},
+		"form:image:a.jpg":  {Name: "image", File: "a.jpg", Filename: "a.jpg", ContentType: "application/octet-stream"},
+		"form:dir/a=b.jpg":  {Name: "file", File: "dir/a=b.jpg", Filename: "dir/a=b.jpg", ContentType: "application/octet-stream"},
+		"form:album=7":      {Name: "album", Value: "7"},
+		"form:tags=a=b;c":   {Name: "tags", Value: "a=b;c"},
+		"form:tags=":        {Name: "tags"},
+		"form:photo=@a.jpg": {Name: "photo", File: "a.jpg"},
+		"form:photo=@a.jpg;type=image/png;filename=b.png": {Name: "photo", File: "a.jpg", ContentType: "image/png", Filename: "b.png"},
+	} {
+		got, err := parseFormPart(directive)
+		if err != nil {
+			t.Errorf("`%s` should be valid: %s", directive, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("`%s`: want: %+v, got: %+v", directive, want, got)
+		}
+	}
+
+	for _, directive := range []string{"form:", "form:a:b:c", "form:=1", "form:a=@", "form:a=@b;type", "form:a=@b;lolcat=1"} {
+		if _, err := parseFormPart(directive); err == nil {
+			t.Errorf("`%s` shouldn't be valid", directive)
+		}
+	}
+}
+
+func TestFormRequest(t *testing.T) {
+	t.Parallel()
+
+	photo := tempFile(t, []byte("jpeg data"))
+	defer os.Remove(photo)
+	notes := tempFile(t, []byte("some notes"))
+	defer os.Remove(notes)
+
+	line := "POST http://lolcathost:9999/ form:album=7 form:tags=\"a b\" " +
+		"form:photo=@" + photo + ";type=image/jpeg;filename=a.jpg form:notes=@" + notes
+	for _, budget := range []int64{0, DefaultBodyCache} {
+		targets, err := NewTargets([]string{line}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = targets.Preload(budget); err != nil {
+			t.Fatal(err)
+		}
+		if streamed := targets[0].payload.parts != nil; streamed != (budget == 0) {
+			t.Fatalf("Budget %d: want streamed: %t, got: %t", budget, budget == 0, streamed)
+		}
+
+		body, ctype := requestBody(t, &targets[0])
+		_, params, err := mime.ParseMediaType(ctype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(form.Value, map[string][]string{"album": {"7"}, "tags": {"a b"}}) {
+			t.Errorf("Budget %d: wrong form values %v", budget, form.Value)
+		}
+
+		for name, want := range map[string][3]string{
+			"photo": {"a.jpg", "image/jpeg", "jpeg data"},
+			"notes": {notes[strings.LastIndex(notes, "/")+1:], "application/octet-stream", "some notes"},
+		} {
+			if len(form.File[name]) != 1 {
+				t.Fatalf("Budget %d: missing form file %s", budget, name)
+			}
+			fh := form.File[name][0]
+			f, err := fh.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := ioutil.ReadAll(f)
+			f.Close()
+			if got := [3]string{fh.Filename, fh.Header.Get("Content-Type"), string(content)}; got != want {
+				t.Errorf("Budget %d: wrong form file %s. Want: %q, Got: %q", budget, name, want, got)
+			}
+		}
+	}
+}
+
+func TestJSONFormRequest(t *testing.T) {
+	t.Parallel()
+
+	name := tempFile(t, []byte("lolcat"))
+	defer os.Remove(name)
+
+	line := `{"method": "PUT", "url": "http://lolcathost:9999/", "form": [` +
+		`{"name": "id", "value": "7", "type": "text/plain"}, {"name": "cat", "file": "` + name + `", "filename": "cat.txt"}]}`
+	targets, err := NewJSONTargets([]string{line}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, ctype := requestBody(t, &targets[0])
+	_, params, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for _, want := range [][3]string{{"id", "text/plain", "7"}, {"cat", "application/octet-stream", "lolcat"}} {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(part)
+		if got := [3]string{part.FormName(), part.Header.Get("Content-Type"), string(content)}; got != want {
+			t.Errorf("Wrong form part. Want: %q, Got: %q", want, got)
+		}
+	}
+}
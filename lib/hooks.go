@@ -0,0 +1,41 @@
+package stress
+
+import "net/http"
+
+// RequestHook is called with every request right before it is signed and
+// sent, once it is authenticated, so that it can be tagged or altered.
+// Hooks are called concurrently from every worker.
+type RequestHook interface {
+	BeforeRequest(req *http.Request)
+}
+
+// ResponseHook is called with every response and its Result once the
+// response body is read and checked. The body can be read again out of
+// res.Body, and the Result changed, e.g. to fail the request with an Error
+// and a 250 Code. Requests failed without a response don't call hooks.
+// Hooks are called concurrently from every worker.
+type ResponseHook interface {
+	AfterResponse(res *http.Response, r *Result)
+}
+
+// RequestHookFunc is a function usable as a RequestHook
+type RequestHookFunc func(req *http.Request)
+
+// BeforeRequest calls f(req)
+func (f RequestHookFunc) BeforeRequest(req *http.Request) { f(req) }
+
+// ResponseHookFunc is a function usable as a ResponseHook
+type ResponseHookFunc func(res *http.Response, r *Result)
+
+// AfterResponse calls f(res, r)
+func (f ResponseHookFunc) AfterResponse(res *http.Response, r *Result) { f(res, r) }
+
+// AddRequestHook adds a RequestHook called after the ones already added.
+func (a *Attacker) AddRequestHook(h RequestHook) {
+	a.requestHooks = append(a.requestHooks, h)
+}
+
+// AddResponseHook adds a ResponseHook called after the ones already added.
+func (a *Attacker) AddResponseHook(h ResponseHook) {
+	a.responseHooks = append(a.responseHooks, h)
+}
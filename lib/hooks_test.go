@@ -0,0 +1,53 @@
+package stress
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get("X-Tag")))
+		}),
+	)
+
+	var order []string
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.AddRequestHook(RequestHookFunc(func(req *http.Request) {
+		order = append(order, "request")
+		req.Header.Set("X-Tag", "lolcat")
+	}))
+	for _, name := range []string{"response 1", "response 2"} {
+		name := name
+		atk.AddResponseHook(ResponseHookFunc(func(res *http.Response, r *Result) {
+			order = append(order, name)
+			// Every hook reads the whole body
+			if body, _ := ioutil.ReadAll(res.Body); string(body) != "lolcat" {
+				r.Code, r.Error = 250, "untagged: "+string(body)
+			}
+		}))
+	}
+
+	results := atk.AttackConcy(Targets{{Method: "GET", URL: server.URL}}, 1, 1)
+	if len(results) != 1 || results[0].Code != 200 || results[0].Error != "" {
+		t.Fatalf("Wrong results: %+v", results)
+	}
+	if want := "[request response 1 response 2]"; fmt.Sprint(order) != want {
+		t.Errorf("Wrong hooks order. Want: %s, Got: %v", want, order)
+	}
+
+	// Response hooks may fail requests
+	atk.AddResponseHook(ResponseHookFunc(func(res *http.Response, r *Result) {
+		r.Code, r.Error = 250, "rejected"
+	}))
+	results = atk.AttackConcy(Targets{{Method: "GET", URL: server.URL}}, 1, 1)
+	if len(results) != 1 || results[0].Code != 250 || results[0].Error != "rejected" {
+		t.Errorf("Wrong results: %+v", results)
+	}
+}
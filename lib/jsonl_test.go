@@ -0,0 +1,115 @@
+package stress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewJSONTargets(t *testing.T) {
+	t.Parallel()
+
+	lines := []string{
+		`{"method": "put", "url": "http://lolcathost:9999/a", "header": {"authorization": ["Bearer x y"], "Referer": ["http://a:b/"]}, "body": "lolcat", "content_type": "text/plain"}`,
+		``,
+		`// {"url": "http://lolcathost:9999/comment"}`,
+		`{"url": "http://lolcathost:9999/b", "body_base64": "AAEC", "timeout": "2s", "redirects": 0, "proxy": "direct", "retry": {"count": 2, "on": ["429"]}, "expect": {"status": [200, 304], "md5": "5f189d8ec57f5a5a0d3dcba47fa797e2"}}`,
+	}
+	targets, err := NewJSONTargets(lines, []byte("global"), http.Header{"X-Global": []string{"1"}, "Referer": []string{"lolcathost"}})
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("Wrong number of targets. Want: 2, Got: %d", len(targets))
+	}
+
+	a, b := targets[0], targets[1]
+	if a.Method != "PUT" || a.URL != "http://lolcathost:9999/a" || string(a.Body) != "lolcat" || a.ContentType != "text/plain" {
+		t.Errorf("Target was parsed incorrectly: %s %s %s %s", a.Method, a.URL, a.Body, a.ContentType)
+	}
+	for k, want := range map[string]string{"Authorization": "Bearer x y", "Referer": "http://a:b/", "X-Global": "1"} {
+		if got := a.Header.Get(k); got != want {
+			t.Errorf("Wrong %s header. Want: %s, Got: %s", k, want, got)
+		}
+	}
+
+	if b.Method != "GET" || !bytes.Equal(b.Body, []byte{0, 1, 2}) || b.Timeout != 2*time.Second {
+		t.Errorf("Target was parsed incorrectly: %s %v %s", b.Method, b.Body, b.Timeout)
+	}
+	if b.Redirects != NoRedirects || b.Proxy != NoProxy || b.Retry.Count != 2 || b.Retry.Errors || len(b.Retry.Statuses) != 1 {
+		t.Errorf("Target options were parsed incorrectly: %d %s %+v", b.Redirects, b.Proxy, b.Retry)
+	}
+	if len(b.Expect.Status) != 2 || b.Expect.MD5 == "" {
+		t.Errorf("Target assertions were parsed incorrectly: %+v", b.Expect)
+	}
+}
+
+func TestNewJSONTargetsErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range []string{
+		`{"method": "GET"}`,
+		`{"url": "http://lolcathost:9999/", "lolcat": true}`,
+		`{"url": "http://lolcathost:9999/", "body": "a", "body_file": "b"}`,
+		`{"url": "http://lolcathost:9999/", "body": "a", "form": [{"name": "b", "value": "c"}]}`,
+		`{"url": "http://lolcathost:9999/", "form": [{"value": "c"}]}`,
+		`{"url": "http://lolcathost:9999/", "form": [{"name": "b", "value": "c"}], "content_type": "a/b"}`,
+		`{"url": "http://lolcathost:9999/", "body_base64": "!!"}`,
+		`{"url": "http://lolcathost:9999/", "body": "a", "template": true}`,
+		`{"url": "http://lolcathost:9999/", "timeout": "soon"}`,
+		`{"url": "http://lolcathost:9999/", "redirects": -1}`,
+		`{"url": "http://lolcathost:9999/", "proxy": "lolcat"}`,
+		`{"url": "http://lolcathost:9999/", "retry": {"count": 1, "backoff": "soon"}}`,
+		`{"url": "http://lolcathost:9999/", "retry": {"count": 1, "on": ["lolcat"]}}`,
+		`{"url": "http://lolcathost:9999/"`,
+	} {
+		_, err := NewJSONTargets([]string{"", line}, nil, nil)
+		if err == nil || !strings.HasPrefix(err.Error(), "Invalid target at line 2") {
+			t.Errorf("Target `%s` shouldn't be valid: %v", line, err)
+		}
+	}
+}
+
+func TestReadTargetsFormat(t *testing.T) {
+	t.Parallel()
+
+	f, err := ioutil.TempFile("", "stress-body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	want := []byte("lolcat {{ not a template")
+	if _, err = f.Write(want); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	src := "// comment\n{\"url\": \"http://lolcathost:9999/\", \"body_file\": \"" + f.Name() + "\"}\n"
+	targets, err := ReadTargets(strings.NewReader(src), FormatAuto, nil, nil)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+
+	req, err := targets[0].Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, body) {
+		t.Fatalf("Wrong body. Want: %s, Got: %s", want, body)
+	}
+
+	if _, err := ReadTargets(strings.NewReader(src), FormatText, nil, nil); err == nil {
+		t.Error("JSON Lines shouldn't be valid text targets")
+	}
+	if _, err := ReadTargets(strings.NewReader(src), "lolcat", nil, nil); err == nil {
+		t.Error("Format `lolcat` shouldn't be valid")
+	}
+}
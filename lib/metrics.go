@@ -1,6 +1,7 @@
 package stress
 
 import (
+	"sort"
 	"strconv"
 	"time"
 
@@ -18,9 +19,12 @@ type Metrics struct {
 		Max  time.Duration `json:"max"`
 	} `json:"latencies"`
 
+	// BytesIn counts the decoded bytes of the response bodies, Encoded the
+	// ones received
 	BytesIn struct {
-		Total uint64  `json:"total"`
-		Mean  float64 `json:"mean"`
+		Total   uint64  `json:"total"`
+		Mean    float64 `json:"mean"`
+		Encoded uint64  `json:"encoded"`
 	} `json:"bytes_in"`
 
 	BytesOut struct {
@@ -28,56 +32,227 @@ type Metrics struct {
 		Mean  float64 `json:"mean"`
 	} `json:"bytes_out"`
 
+	// WireIn and WireOut count the bytes read and written on the wire, see
+	// Result
+	WireIn struct {
+		Total uint64  `json:"total"`
+		Mean  float64 `json:"mean"`
+	} `json:"wire_in"`
+
+	WireOut struct {
+		Total uint64  `json:"total"`
+		Mean  float64 `json:"mean"`
+	} `json:"wire_out"`
+
+	// Attempts tells the success ratios of the first attempts of requests
+	// and of their last attempts, once retried
+	Attempts struct {
+		Retries         uint64  `json:"retries"`
+		FirstSuccess    float64 `json:"first_success"`
+		EventualSuccess float64 `json:"eventual_success"`
+	} `json:"attempts"`
+
+	// Phases are the mean phases of setting up the new connections the
+	// requests were sent over (see Result), Proxy being the mean of the
+	// Proxies connections set up with a proxy handshake
+	Phases struct {
+		Connections uint64        `json:"connections"`
+		Connect     time.Duration `json:"connect"`
+		Proxies     uint64        `json:"proxies"`
+		Proxy       time.Duration `json:"proxy"`
+		TLS         time.Duration `json:"tls"`
+	} `json:"phases"`
+
 	Duration    time.Duration  `json:"duration"`
 	Requests    uint64         `json:"requests"`
 	QPS         float64        `json:"qps"`
 	Success     float64        `json:"success"`
 	StatusCodes map[string]int `json:"status_codes"`
-	Errors      []string       `json:"errors"`
+	// Timeouts counts the requests failed with each kind of timeout
+	Timeouts map[string]int `json:"timeouts"`
+	// Stopped tells why the attack was stopped early, if it was
+	Stopped string `json:"stopped,omitempty"`
+	// Thresholds are the results of the Thresholds checked, if any
+	Thresholds []ThresholdResult `json:"thresholds,omitempty"`
+	// Encodings counts the responses of each content encoding
+	Encodings map[string]int `json:"encodings"`
+	Errors    []string       `json:"errors"`
 }
 
 // NewMetrics computes and returns a Metrics struct out of a slice of Results
 func NewMetrics(results []Result) *Metrics {
-	m := &Metrics{StatusCodes: map[string]int{}}
-	if len(results) == 0 {
-		return m
+	g := NewAggregator()
+	for _, result := range results {
+		g.Add(result)
+	}
+	return g.Metrics()
+}
+
+// Aggregator computes Metrics incrementally out of Results added one at a
+// time, so that they can be told while an attack is running. Results may
+// be added in any order.
+type Aggregator struct {
+	m               Metrics
+	quants          *quantile.Stream
+	errors          map[string]int
+	totalSuccess    int
+	totalLatencies  time.Duration
+	first           int
+	firstSuccess    int
+	eventual        int
+	eventualSuccess int
+	earliest        time.Time
+	latest          time.Time
+}
+
+// NewAggregator returns a new Aggregator without any Result
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		m:      Metrics{StatusCodes: map[string]int{}, Timeouts: map[string]int{}, Encodings: map[string]int{}},
+		quants: quantile.NewTargeted(0.50, 0.95, 0.99),
+		errors: map[string]int{},
 	}
-	errorSet := map[string]struct{}{}
-	quants := quantile.NewTargeted(0.50, 0.95, 0.99)
-	totalSuccess, totalLatencies := 0, time.Duration(0)
+}
 
-	for _, result := range results {
-		quants.Insert(float64(result.Latency))
-		m.StatusCodes[strconv.Itoa(int(result.Code))]++
-		totalLatencies += result.Latency
-		m.BytesOut.Total += result.BytesOut
-		m.BytesIn.Total += result.BytesIn
-		if result.Latency > m.Latencies.Max {
-			m.Latencies.Max = result.Latency
+// Add adds result to the Metrics
+func (g *Aggregator) Add(result Result) {
+	m := &g.m
+	m.Requests++
+	g.quants.Insert(float64(result.Latency))
+	m.StatusCodes[strconv.Itoa(int(result.Code))]++
+	g.totalLatencies += result.Latency
+	m.BytesOut.Total += result.BytesOut
+	m.BytesIn.Total += result.BytesIn
+	m.BytesIn.Encoded += result.BytesInEncoded
+	m.WireIn.Total += result.WireIn
+	m.WireOut.Total += result.WireOut
+	if result.Latency > m.Latencies.Max {
+		m.Latencies.Max = result.Latency
+	}
+	if g.earliest.IsZero() || result.Timestamp.Before(g.earliest) {
+		g.earliest = result.Timestamp
+	}
+	if result.Timestamp.After(g.latest) {
+		g.latest = result.Timestamp
+	}
+	success := result.Success()
+	if success {
+		g.totalSuccess++
+	}
+	if result.Attempt <= 1 {
+		g.first++
+		if success {
+			g.firstSuccess++
 		}
-		if result.Code >= 200 && result.Code < 250 {
-			totalSuccess++
+	} else {
+		m.Attempts.Retries++
+	}
+	if !result.Retried {
+		g.eventual++
+		if success {
+			g.eventualSuccess++
 		}
-		if result.Error != "" {
-			errorSet[result.Error] = struct{}{}
+	}
+	if result.Error != "" {
+		g.errors[result.Error]++
+	}
+	if result.Timeout != "" {
+		m.Timeouts[result.Timeout]++
+	}
+	if result.Stopped != "" {
+		m.Stopped = result.Stopped
+	}
+	if result.Encoding != "" {
+		m.Encodings[result.Encoding]++
+	}
+	if result.Connect > 0 {
+		m.Phases.Connections++
+		m.Phases.Connect += result.Connect
+		m.Phases.TLS += result.TLS
+		if result.Proxy > 0 {
+			m.Phases.Proxies++
+			m.Phases.Proxy += result.Proxy
 		}
 	}
+}
+
+// Metrics returns the Metrics of the Results added so far
+func (g *Aggregator) Metrics() *Metrics {
+	m := g.m
+	m.StatusCodes = copyCounts(g.m.StatusCodes)
+	m.Timeouts = copyCounts(g.m.Timeouts)
+	m.Encodings = copyCounts(g.m.Encodings)
+	if m.Requests == 0 {
+		return &m
+	}
 
-	m.Requests = uint64(len(results))
-	m.Duration = results[len(results)-1].Timestamp.Sub(results[0].Timestamp)
-	m.QPS = float64(m.Requests) / m.Duration.Seconds()
-	m.Latencies.Mean = time.Duration(float64(totalLatencies) / float64(m.Requests))
-	m.Latencies.P50 = time.Duration(quants.Query(0.50))
-	m.Latencies.P95 = time.Duration(quants.Query(0.95))
-	m.Latencies.P99 = time.Duration(quants.Query(0.99))
+	// A single result has no QPS
+	if m.Duration = g.latest.Sub(g.earliest); m.Duration > 0 {
+		m.QPS = float64(m.Requests) / m.Duration.Seconds()
+	}
+	m.Latencies.Mean = time.Duration(float64(g.totalLatencies) / float64(m.Requests))
+	m.Latencies.P50 = time.Duration(g.quants.Query(0.50))
+	m.Latencies.P95 = time.Duration(g.quants.Query(0.95))
+	m.Latencies.P99 = time.Duration(g.quants.Query(0.99))
 	m.BytesIn.Mean = float64(m.BytesIn.Total) / float64(m.Requests)
 	m.BytesOut.Mean = float64(m.BytesOut.Total) / float64(m.Requests)
-	m.Success = float64(totalSuccess) / float64(m.Requests)
+	m.WireIn.Mean = float64(m.WireIn.Total) / float64(m.Requests)
+	m.WireOut.Mean = float64(m.WireOut.Total) / float64(m.Requests)
+	m.Success = float64(g.totalSuccess) / float64(m.Requests)
+	if g.first > 0 {
+		m.Attempts.FirstSuccess = float64(g.firstSuccess) / float64(g.first)
+	}
+	if n := time.Duration(m.Phases.Connections); n > 0 {
+		m.Phases.Connect /= n
+		m.Phases.TLS /= n
+	}
+	if n := time.Duration(m.Phases.Proxies); n > 0 {
+		m.Phases.Proxy /= n
+	}
+	if g.eventual > 0 {
+		m.Attempts.EventualSuccess = float64(g.eventualSuccess) / float64(g.eventual)
+	}
 
-	m.Errors = make([]string, 0, len(errorSet))
-	for err := range errorSet {
+	m.Errors = make([]string, 0, len(g.errors))
+	for err := range g.errors {
 		m.Errors = append(m.Errors, err)
 	}
 
-	return m
+	return &m
+}
+
+// ErrorCounts returns how many of the Results added so far failed with
+// each error
+func (g *Aggregator) ErrorCounts() map[string]int { return copyCounts(g.errors) }
+
+// ErrorCount is the number of results failed with an error
+type ErrorCount struct {
+	Error string `json:"error"`
+	Count int    `json:"count"`
+}
+
+// TopErrors returns the n most frequent errors out of ErrorCounts
+func TopErrors(counts map[string]int, n int) []ErrorCount {
+	errs := make([]ErrorCount, 0, len(counts))
+	for err, count := range counts {
+		errs = append(errs, ErrorCount{err, count})
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		if errs[i].Count != errs[j].Count {
+			return errs[i].Count > errs[j].Count
+		}
+		return errs[i].Error < errs[j].Error
+	})
+	if len(errs) > n {
+		errs = errs[:n]
+	}
+	return errs
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	c := make(map[string]int, len(counts))
+	for k, n := range counts {
+		c[k] = n
+	}
+	return c
 }
@@ -1,6 +1,7 @@
 package stress
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
@@ -9,9 +10,9 @@ func TestNewMetrics(t *testing.T) {
 	t.Parallel()
 
 	m := NewMetrics([]Result{
-		Result{500, time.Unix(0, 0), 100 * time.Millisecond, 10, 30, "Internal server error"},
-		Result{200, time.Unix(1, 0), 20 * time.Millisecond, 20, 20, ""},
-		Result{200, time.Unix(2, 0), 30 * time.Millisecond, 30, 10, ""},
+		Result{Code: 500, Timestamp: time.Unix(0, 0), Latency: 100 * time.Millisecond, BytesOut: 10, BytesIn: 30, Error: "Internal server error"},
+		Result{Code: 200, Timestamp: time.Unix(1, 0), Latency: 20 * time.Millisecond, BytesOut: 20, BytesIn: 20},
+		Result{Code: 200, Timestamp: time.Unix(2, 0), Latency: 30 * time.Millisecond, BytesOut: 30, BytesIn: 10},
 	})
 
 	for field, values := range map[string][]float64{
@@ -56,3 +57,87 @@ func TestNewMetrics(t *testing.T) {
 		t.Errorf("Errors: want: %v, got: %v", []string{err}, m.Errors)
 	}
 }
+
+func TestMetricsTimeouts(t *testing.T) {
+	t.Parallel()
+
+	m := NewMetrics([]Result{
+		{Timestamp: time.Unix(0, 0), Error: "a", Timeout: TimeoutHeader},
+		{Timestamp: time.Unix(1, 0), Error: "b", Timeout: TimeoutHeader},
+		{Timestamp: time.Unix(2, 0), Error: "c", Timeout: TimeoutConnect},
+		{Timestamp: time.Unix(3, 0), Code: 200},
+	})
+	if want := map[string]int{TimeoutHeader: 2, TimeoutConnect: 1}; !reflect.DeepEqual(m.Timeouts, want) {
+		t.Errorf("Timeouts: want: %v, got: %v", want, m.Timeouts)
+	}
+}
+
+func TestMetricsPhases(t *testing.T) {
+	t.Parallel()
+
+	m := NewMetrics([]Result{
+		{Timestamp: time.Unix(0, 0), Code: 200, Connect: 2 * time.Millisecond, Proxy: 4 * time.Millisecond, TLS: 6 * time.Millisecond},
+		{Timestamp: time.Unix(1, 0), Code: 200, Connect: 4 * time.Millisecond, TLS: 2 * time.Millisecond},
+		// Requests over reused connections are left out
+		{Timestamp: time.Unix(2, 0), Code: 200},
+	})
+	// The proxy handshake is the mean of the connections which had one
+	p := m.Phases
+	if p.Connections != 2 || p.Connect != 3*time.Millisecond || p.Proxies != 1 || p.Proxy != 4*time.Millisecond || p.TLS != 4*time.Millisecond {
+		t.Errorf("Wrong phases: %+v", p)
+	}
+}
+
+func TestMetricsEncodings(t *testing.T) {
+	t.Parallel()
+
+	m := NewMetrics([]Result{
+		{Timestamp: time.Unix(0, 0), Code: 200, Encoding: "gzip", BytesIn: 100, BytesInEncoded: 20},
+		{Timestamp: time.Unix(1, 0), Code: 200, Encoding: "gzip", BytesIn: 100, BytesInEncoded: 30},
+		{Timestamp: time.Unix(2, 0), Code: 200, BytesIn: 50, BytesInEncoded: 50},
+	})
+	if want := map[string]int{"gzip": 2}; !reflect.DeepEqual(m.Encodings, want) {
+		t.Errorf("Encodings: want: %v, got: %v", want, m.Encodings)
+	}
+	if m.BytesIn.Total != 250 || m.BytesIn.Encoded != 100 {
+		t.Errorf("Wrong bytes in: %+v", m.BytesIn)
+	}
+}
+
+func TestMetricsWire(t *testing.T) {
+	t.Parallel()
+
+	m := NewMetrics([]Result{
+		{Timestamp: time.Unix(0, 0), Code: 200, WireIn: 300, WireOut: 100},
+		{Timestamp: time.Unix(1, 0), Code: 200, WireIn: 100, WireOut: 50},
+	})
+	if m.WireIn.Total != 400 || m.WireIn.Mean != 200 || m.WireOut.Total != 150 || m.WireOut.Mean != 75 {
+		t.Errorf("Wrong wire bytes: %+v %+v", m.WireIn, m.WireOut)
+	}
+}
+
+func TestMetricsStopped(t *testing.T) {
+	t.Parallel()
+
+	m := NewMetrics([]Result{
+		{Timestamp: time.Unix(0, 0), Code: 500},
+		{Timestamp: time.Unix(1, 0), Code: 500, Stopped: "2 errors reached the limit of 2"},
+		{Timestamp: time.Unix(2, 0), Code: 500},
+	})
+	if m.Stopped != "2 errors reached the limit of 2" {
+		t.Errorf("Wrong stop reason: %q", m.Stopped)
+	}
+	if m = NewMetrics([]Result{{Code: 200}}); m.Stopped != "" {
+		t.Errorf("Unexpected stop reason: %q", m.Stopped)
+	}
+}
+
+func TestTopErrors(t *testing.T) {
+	t.Parallel()
+
+	counts := map[string]int{"a": 1, "b": 5, "c": 3, "d": 3}
+	want := []ErrorCount{{"b", 5}, {"c", 3}, {"d", 3}}
+	if got := TopErrors(counts, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong top errors. Want: %v, Got: %v", want, got)
+	}
+}
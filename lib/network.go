@@ -0,0 +1,166 @@
+package stress
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Network emulates the conditions of the network clients reach the targets
+// through on every connection an Attacker dials. Download and Upload cap the
+// bandwidth of each connection in bytes per second. Latency, give or take a
+// random Jitter, is added to every round trip: half of it before the
+// connection starts writing and half of it once it reads the answer. Zero
+// values leave the network as is.
+type Network struct {
+	Download int64
+	Upload   int64
+	Latency  time.Duration
+	Jitter   time.Duration
+}
+
+// networks are the Network presets, close to the ones of browser devtools
+var networks = map[string]Network{
+	"slow-3g": {Download: 50 << 10, Upload: 50 << 10, Latency: 400 * time.Millisecond},
+	"3g":      {Download: 200 << 10, Upload: 96 << 10, Latency: 150 * time.Millisecond, Jitter: 20 * time.Millisecond},
+	"4g":      {Download: 1 << 20, Upload: 384 << 10, Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond},
+}
+
+// ParseNetwork parses a Network described like:
+//
+//	[PRESET;]down=SIZE;up=SIZE;latency=DURATION;jitter=DURATION
+//
+// where sizes like 200KB are bytes per second and PRESET is one of
+// slow-3g, 3g or 4g, whose options are overridden by the following ones.
+func ParseNetwork(spec string) (Network, error) {
+	opts := strings.Split(spec, ";")
+	var n Network
+	if preset, ok := networks[opts[0]]; ok {
+		n, opts = preset, opts[1:]
+	}
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return Network{}, fmt.Errorf("option `%s` is invalid", opt)
+		}
+		var err error
+		switch kv[0] {
+		case "down":
+			n.Download, err = parseSize(kv[1])
+		case "up":
+			n.Upload, err = parseSize(kv[1])
+		case "latency":
+			n.Latency, err = time.ParseDuration(kv[1])
+		case "jitter":
+			n.Jitter, err = time.ParseDuration(kv[1])
+		default:
+			return Network{}, fmt.Errorf("option `%s` is invalid", opt)
+		}
+		if err != nil || n.Latency < 0 || n.Jitter < 0 {
+			return Network{}, fmt.Errorf("%s `%s` is invalid", kv[0], kv[1])
+		}
+	}
+	return n, nil
+}
+
+// SetNetwork sets the Network conditions emulated on every new connection.
+func (a *Attacker) SetNetwork(n Network) { a.network = n }
+
+// shapedConn is a connection going through an emulated Network
+type shapedConn struct {
+	net.Conn
+	network  Network
+	down, up pacer
+	// writing tells whether the connection last wrote or read
+	writing int32
+}
+
+func newShapedConn(conn net.Conn, n Network) net.Conn {
+	if n == (Network{}) {
+		return conn
+	}
+	return &shapedConn{Conn: conn, network: n, down: pacer{rate: n.Download}, up: pacer{rate: n.Upload}}
+}
+
+func (c *shapedConn) Write(p []byte) (int, error) {
+	if atomic.CompareAndSwapInt32(&c.writing, 0, 1) {
+		time.Sleep(c.delay())
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := c.up.chunk(len(p))
+		n, err := c.Conn.Write(p[:chunk])
+		written += n
+		c.up.pace(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (c *shapedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p[:c.down.chunk(len(p))])
+	if n > 0 && atomic.CompareAndSwapInt32(&c.writing, 1, 0) {
+		time.Sleep(c.network.Latency - c.network.Latency/2)
+	}
+	c.down.pace(n)
+	return n, err
+}
+
+// delay returns the half of the latency slept before writing, with jitter
+func (c *shapedConn) delay() time.Duration {
+	d := c.network.Latency / 2
+	if j := int64(c.network.Jitter); j > 0 {
+		d += time.Duration(rand.Int63n(2*j+1) - j)
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// pacer paces the bytes going one way through a connection at rate bytes
+// per second, zero not pacing them
+type pacer struct {
+	rate int64
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// chunk returns how many of n bytes go through at once, about 50ms worth
+func (p *pacer) chunk(n int) int {
+	if p.rate == 0 {
+		return n
+	}
+	max := p.rate / 20
+	if max < 512 {
+		max = 512
+	}
+	if int64(n) > max {
+		return int(max)
+	}
+	return n
+}
+
+// pace waits for n bytes which went through to be due
+func (p *pacer) pace(n int) {
+	if p.rate == 0 || n == 0 {
+		return
+	}
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	p.next = p.next.Add(time.Duration(int64(n) * int64(time.Second) / p.rate))
+	wait := p.next.Sub(now)
+	p.mu.Unlock()
+	time.Sleep(wait)
+}
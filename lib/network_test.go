@@ -0,0 +1,68 @@
+package stress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNetwork(t *testing.T) {
+	t.Parallel()
+
+	for spec, want := range map[string]Network{
+		"3g":                          networks["3g"],
+		"3g;jitter=0s":                {Download: 200 << 10, Upload: 96 << 10, Latency: 150 * time.Millisecond},
+		"down=1MB;up=64KB;latency=1s": {Download: 1 << 20, Upload: 64 << 10, Latency: time.Second},
+	} {
+		got, err := ParseNetwork(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want: %+v, got: %+v", spec, want, got)
+		}
+	}
+
+	for _, spec := range []string{"5g", "3g;down", "down=fast", "latency=-1s", "lolcat=1"} {
+		if _, err := ParseNetwork(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	t.Parallel()
+
+	body := bytes.Repeat([]byte("lolcat"), 10<<10)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := ioutil.ReadAll(r.Body)
+			if len(n) == 0 {
+				w.Write(body)
+			}
+		}),
+	)
+
+	for _, c := range []struct {
+		network Network
+		tgt     Target
+		min     time.Duration
+	}{
+		// 60KB at 200KB/s
+		{Network{Download: 200 << 10}, Target{Method: "GET", URL: server.URL}, 250 * time.Millisecond},
+		{Network{Upload: 200 << 10}, Target{Method: "PUT", URL: server.URL, Body: body}, 250 * time.Millisecond},
+		{Network{Latency: 200 * time.Millisecond}, Target{Method: "GET", URL: server.URL}, 200 * time.Millisecond},
+	} {
+		atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+		atk.SetNetwork(c.network)
+		began := time.Now()
+		res := atk.AttackConcy(Targets{c.tgt}, 1, 1)[0]
+		if elapsed := time.Since(began); res.Code != 200 || elapsed < c.min {
+			t.Errorf("%+v: want at least %s, got %s: %+v", c.network, c.min, elapsed, res)
+		}
+	}
+}
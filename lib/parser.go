@@ -0,0 +1,390 @@
+package stress
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The text targets format describes every target with a request line:
+//
+//	METHOD [Header:value ...] URL [@bodyfile | body:text | synth:spec | form:part ... | postfile] [type:mime] [encoding:name] [md5:hash]
+//		[timeout:duration] [redirects:n] [proxy:url] [retry:count[;backoff=duration][;on=condition,...]]
+//
+// Tokens are separated by spaces or tabs. Double quoted tokens may contain
+// spaces and the escapes \" \\ \n \r and \t, single quoted tokens are taken
+// literally, a backslash escapes the next character anywhere else and
+// template actions like {{randInt 1 10}} always stay within one token:
+//
+//	GET "Authorization: Bearer x" Referer:http://goku/ X-Src:httpd http://goku:9090/path
+//
+// Any method may have a body: a body file, an inline body:text, a synthetic
+// body (see NewSynthetic) or a multipart form, whose content type is set by type:mime unless the headers set one.
+// encoding:name compresses the body, e.g. with gzip (see RegisterCodec).
+// Every form:name=value or form:name=@file[;type=mime][;filename=name] token
+// adds a part to the multipart form body of the target:
+//
+//	POST http://goku:9090/photos form:album=7 form:photo=@a.jpg;type=image/jpeg form:photo=@b.png
+//
+// timeout, redirects, proxy and retry override the timeout, redirects and
+// proxy of the Attacker and set the retry policy of the target (see Retry),
+// redirects:0 not following redirects at all and proxy:direct not using any
+// proxy.
+//
+// Headers may also follow the request line one per line, and an inline body
+// may follow them after a blank line. The body lasts until the next blank
+// line:
+//
+//	POST http://goku:9090/users
+//	Content-Type: application/json
+//
+//	{"name": "{{randString 8}}"}
+//
+// Lines starting with # or // are comments. Malformed lines are reported
+// along with their line number.
+
+// textParser states
+const (
+	// expecting a request line
+	stateRequest = iota
+	// after a request line, expecting header lines
+	stateHeaders
+	// after a blank line following a target, expecting its inline body
+	stateBlank
+	// within an inline body
+	stateBody
+)
+
+// textParser parses the text targets format line by line
+type textParser struct {
+	body    []byte
+	header  http.Header
+	targets Targets
+	lines   []int
+
+	state     int
+	custom    map[string]bool
+	hasBody   bool
+	bodyLines []string
+}
+
+func newTextParser(body []byte, header http.Header) *textParser {
+	return &textParser{body: body, header: header}
+}
+
+// errorf returns an error located at line n
+func (p *textParser) errorf(n int, format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid target at line %d: %s", n, fmt.Sprintf(format, args...))
+}
+
+// parseLine parses the nth line of the source
+func (p *textParser) parseLine(n int, line string) error {
+	line = strings.TrimRight(line, "\r")
+	trimmed := strings.TrimSpace(line)
+
+	if p.state == stateBody {
+		if trimmed == "" {
+			p.endBody()
+		} else {
+			p.bodyLines = append(p.bodyLines, line)
+		}
+		return nil
+	}
+
+	method := startsWithMethod(trimmed)
+	switch {
+	case trimmed == "":
+		if p.state == stateHeaders {
+			p.state = stateBlank
+		}
+	case isComment(trimmed):
+	case method && (p.state != stateBlank || len(strings.Fields(trimmed)) > 1):
+		return p.parseRequest(n, trimmed)
+	case p.state == stateHeaders:
+		name, value, err := parseHeader(trimmed)
+		if err != nil {
+			return p.errorf(n, "%s", err)
+		}
+		p.setHeader(name, value)
+	case p.state == stateBlank:
+		if p.hasBody {
+			return p.errorf(n, "inline body of a target which already has a body")
+		}
+		p.state, p.bodyLines = stateBody, []string{line}
+	default:
+		return p.errorf(n, "unexpected `%s`, expected a request line", trimmed)
+	}
+	return nil
+}
+
+// parseRequest parses the request line of a new target
+func (p *textParser) parseRequest(n int, line string) error {
+	tokens, err := tokenize(line)
+	if err != nil {
+		return p.errorf(n, "%s", err)
+	}
+
+	p.targets = append(p.targets, Target{Method: tokens[0], Body: p.body, Header: cloneHeader(p.header)})
+	p.lines = append(p.lines, n)
+	p.state, p.custom, p.hasBody = stateHeaders, map[string]bool{}, false
+	tgt := &p.targets[len(p.targets)-1]
+
+	i := 1
+	for ; i < len(tokens) && isHeaderToken(tokens[i]); i++ {
+		name, value, err := parseHeader(tokens[i])
+		if err != nil {
+			return p.errorf(n, "%s", err)
+		}
+		p.setHeader(name, value)
+	}
+
+	if i == len(tokens) {
+		return p.errorf(n, "missing URL")
+	}
+	tgt.URL = tokens[i]
+	if !isTemplate(tgt.URL) {
+		u, err := url.Parse(tgt.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return p.errorf(n, "invalid header or URL `%s`", tgt.URL)
+		}
+	}
+
+	for _, tok := range tokens[i+1:] {
+		switch {
+		case strings.HasPrefix(tok, "md5:"):
+			sum := tok[len("md5:"):]
+			if b, err := hex.DecodeString(sum); err != nil || len(b) != 16 {
+				return p.errorf(n, "invalid md5 `%s`", sum)
+			}
+			tgt.Expect.MD5 = sum
+			continue
+		case strings.HasPrefix(tok, "timeout:"):
+			timeout, err := time.ParseDuration(tok[len("timeout:"):])
+			if err != nil || timeout <= 0 {
+				return p.errorf(n, "invalid timeout `%s`", tok[len("timeout:"):])
+			}
+			tgt.Timeout = timeout
+			continue
+		case strings.HasPrefix(tok, "redirects:"):
+			redirects, err := strconv.Atoi(tok[len("redirects:"):])
+			if err != nil || redirects < 0 {
+				return p.errorf(n, "invalid redirects `%s`", tok[len("redirects:"):])
+			}
+			if tgt.Redirects = redirects; redirects == 0 {
+				tgt.Redirects = NoRedirects
+			}
+			continue
+		case strings.HasPrefix(tok, "proxy:"):
+			if tgt.Proxy = tok[len("proxy:"):]; tgt.parseProxy() != nil {
+				return p.errorf(n, "%s", tgt.proxy.err)
+			}
+			continue
+		case strings.HasPrefix(tok, "retry:"):
+			if tgt.Retry, err = parseRetry(tok[len("retry:"):]); err != nil {
+				return p.errorf(n, "%s", err)
+			}
+			continue
+		case strings.HasPrefix(tok, "encoding:"):
+			if _, err = encoder(tok[len("encoding:"):]); err != nil {
+				return p.errorf(n, "%s", err)
+			}
+			tgt.ContentEncoding = tok[len("encoding:"):]
+			continue
+		case strings.HasPrefix(tok, "type:"):
+			if tgt.ContentType = tok[len("type:"):]; tgt.ContentType == "" {
+				return p.errorf(n, "missing content type")
+			}
+			continue
+		case strings.HasPrefix(tok, "form:") && (len(tgt.Form) > 0 || !p.hasBody):
+			part, err := parseFormPart(tok)
+			if err != nil {
+				return p.errorf(n, "%s", err)
+			}
+			tgt.Form = append(tgt.Form, part)
+		case p.hasBody:
+			return p.errorf(n, "unexpected `%s`, the target already has a body", tok)
+		case strings.HasPrefix(tok, "@") && len(tok) > 1:
+			tgt.BodyFile = tok[1:]
+		case strings.HasPrefix(tok, "body:"):
+			tgt.Body = []byte(tok[len("body:"):])
+		case strings.HasPrefix(tok, "synth:"):
+			var err error
+			if tgt.Synthetic, err = NewSynthetic(tok[len("synth:"):]); err != nil {
+				return p.errorf(n, "%s", err)
+			}
+		case tgt.Method == "POST":
+			tgt.File = tok
+		default:
+			return p.errorf(n, "unexpected `%s` after the URL", tok)
+		}
+		p.hasBody = true
+	}
+	if len(tgt.Form) > 0 && tgt.ContentType != "" {
+		return p.errorf(n, "multipart forms have their own content type")
+	}
+	return nil
+}
+
+// setHeader sets a header of the current target. The first value of a
+// header replaces the global one, further values are added to it.
+func (p *textParser) setHeader(name, value string) {
+	tgt := &p.targets[len(p.targets)-1]
+	name = http.CanonicalHeaderKey(name)
+	if !p.custom[name] {
+		tgt.Header.Del(name)
+		p.custom[name] = true
+	}
+	tgt.Header.Add(name, value)
+}
+
+// endBody sets the collected inline body on the current target
+func (p *textParser) endBody() {
+	p.targets[len(p.targets)-1].Body = []byte(strings.Join(p.bodyLines, "\n"))
+	p.state, p.hasBody, p.bodyLines = stateRequest, true, nil
+}
+
+// finish ends the parsing and returns the parsed Targets
+func (p *textParser) finish() (Targets, error) {
+	if p.state == stateBody {
+		p.endBody()
+	}
+	for i := range p.targets {
+		if err := p.targets[i].compile(); err != nil {
+			return nil, p.errorf(p.lines[i], "template: %s", err)
+		}
+	}
+	return p.targets, nil
+}
+
+// startsWithMethod reports whether the first field of line is an upper case
+// request method
+func startsWithMethod(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	for _, c := range fields[0] {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// isHeaderToken reports whether tok is a Header:value token rather than an
+// URL. URLs are told apart by their scheme or their leading template action.
+func isHeaderToken(tok string) bool {
+	lower := strings.ToLower(tok)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(tok, "{{") {
+		return false
+	}
+	i := strings.IndexByte(tok, ':')
+	return i > 0 && isHeaderName(tok[:i])
+}
+
+// parseHeader splits a Header:value token or line
+func parseHeader(s string) (name, value string, err error) {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 || !isHeaderName(s[:i]) {
+		return "", "", fmt.Errorf("invalid header `%s`", s)
+	}
+	name, value = s[:i], strings.TrimSpace(s[i+1:])
+	if value == "" {
+		return "", "", fmt.Errorf("header `%s` has no value", name)
+	}
+	return name, value, nil
+}
+
+// isHeaderName reports whether name is a valid header field name
+func isHeaderName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// tokenize splits line into tokens separated by spaces or tabs, honouring
+// quotes, backslash escapes and template actions.
+func tokenize(line string) ([]string, error) {
+	var tokens []string
+	var tok []byte
+	inToken := false
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inToken {
+				tokens, tok, inToken = append(tokens, string(tok)), tok[:0], false
+			}
+			continue
+		case strings.HasPrefix(line[i:], "{{"):
+			end := strings.Index(line[i:], "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated template action")
+			}
+			tok = append(tok, line[i:i+end+2]...)
+			i += end + 1
+		case c == '"':
+			j := i + 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				switch {
+				case strings.HasPrefix(line[j:], "{{"):
+					end := strings.Index(line[j:], "}}")
+					if end < 0 {
+						return nil, fmt.Errorf("unterminated template action")
+					}
+					tok = append(tok, line[j:j+end+2]...)
+					j += end + 1
+				case line[j] == '\\' && j+1 < len(line):
+					j++
+					tok = append(tok, unescape(line[j]))
+				default:
+					tok = append(tok, line[j])
+				}
+			}
+			if j == len(line) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			i = j
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			tok = append(tok, line[i+1:i+1+end]...)
+			i += end + 1
+		case c == '\\' && i+1 < len(line):
+			i++
+			tok = append(tok, line[i])
+		default:
+			tok = append(tok, c)
+		}
+		inToken = true
+	}
+	if inToken {
+		tokens = append(tokens, string(tok))
+	}
+	return tokens, nil
+}
+
+// unescape returns the character escaped by a backslash in a double quoted token
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	}
+	return c
+}
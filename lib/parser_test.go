@@ -0,0 +1,160 @@
+package stress
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	for line, want := range map[string][]string{
+		`GET  http://a/`: {"GET", "http://a/"},
+		"GET\t\"Authorization: Bearer x\" http://a/": {"GET", "Authorization: Bearer x", "http://a/"},
+		`GET X-A:"1 2"'3 4' http://a/`:               {"GET", "X-A:1 23 4", "http://a/"},
+		`GET "X-Q: \"q\"\t\\" http://a/`:             {"GET", "X-Q: \"q\"\t\\", "http://a/"},
+		`GET X-A:a\ b http://a/`:                     {"GET", "X-A:a b", "http://a/"},
+		`GET http://a/{{randInt 1 10}} ""`:           {"GET", "http://a/{{randInt 1 10}}", ""},
+		`GET "X-T: {{env "A B"}}" http://a/`:         {"GET", `X-T: {{env "A B"}}`, "http://a/"},
+	} {
+		got, err := tokenize(line)
+		if err != nil {
+			t.Errorf("`%s` should be valid: %s", line, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("`%s`: want: %q, got: %q", line, want, got)
+		}
+	}
+
+	for _, line := range []string{`GET "http://a/`, `GET 'http://a/`, `GET http://a/{{uuid`} {
+		if _, err := tokenize(line); err == nil {
+			t.Errorf("`%s` shouldn't be valid", line)
+		}
+	}
+}
+
+func TestNewTargetsGrammar(t *testing.T) {
+	t.Parallel()
+
+	src := `# comment
+GET "Authorization: Bearer x y" Referer:http://goku/ X-Src:httpd http://lolcathost:9999/a md5:5f189d8ec57f5a5a0d3dcba47fa797e2
+
+PUT http://lolcathost:9999/b
+Content-Type: application/json
+X-Multi: 1
+X-Multi: 2
+
+{"a": 1,
+  "b": "  two"}
+
+// comment
+POST X-Global:override http://lolcathost:9999/c @body.json
+DELETE http://lolcathost:9999/d timeout:2s redirects:0 proxy:socks5://egress:1080 retry:2;backoff=1s;on=error`
+	header := http.Header{"X-Global": []string{"1"}}
+	targets, err := NewTargets(strings.Split(src, "\n"), []byte("global"), header)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+	if len(targets) != 4 {
+		t.Fatalf("Wrong number of targets. Want: 4, Got: %d", len(targets))
+	}
+
+	a, b, c, d := targets[0], targets[1], targets[2], targets[3]
+	for k, want := range map[string]string{"Authorization": "Bearer x y", "Referer": "http://goku/", "X-Src": "httpd", "X-Global": "1"} {
+		if got := a.Header.Get(k); got != want {
+			t.Errorf("Wrong %s header. Want: %s, Got: %s", k, want, got)
+		}
+	}
+	if a.URL != "http://lolcathost:9999/a" || a.Expect.MD5 != "5f189d8ec57f5a5a0d3dcba47fa797e2" {
+		t.Errorf("Target was parsed incorrectly: %s %+v", a.URL, a.Expect)
+	}
+
+	if want := "{\"a\": 1,\n  \"b\": \"  two\"}"; string(b.Body) != want {
+		t.Errorf("Wrong inline body. Want: %q, Got: %q", want, b.Body)
+	}
+	if got := b.Header["X-Multi"]; !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("Wrong X-Multi header: %v", got)
+	}
+	if b.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Wrong Content-Type header: %s", b.Header.Get("Content-Type"))
+	}
+
+	if c.BodyFile != "body.json" || c.Header.Get("X-Global") != "override" {
+		t.Errorf("Target was parsed incorrectly: %s %v", c.BodyFile, c.Header)
+	}
+	if d.Method != "DELETE" || string(d.Body) != "global" {
+		t.Errorf("Target was parsed incorrectly: %s %s", d.Method, d.Body)
+	}
+	if d.Timeout != 2*time.Second || d.Redirects != NoRedirects || d.Proxy != "socks5://egress:1080" || d.Retry.Count != 2 || !d.Retry.Errors {
+		t.Errorf("Target options were parsed incorrectly: %s %d %s %+v", d.Timeout, d.Redirects, d.Proxy, d.Retry)
+	}
+	if header.Get("X-Global") != "1" {
+		t.Error("Targets must not alter the global header")
+	}
+}
+
+func TestNewTargetsBodies(t *testing.T) {
+	t.Parallel()
+
+	src := `PUT http://lolcathost:9999/a "body:{\"n\": {{.Seq}}}" type:application/json
+PATCH http://lolcathost:9999/b type:text/plain body:lolcat
+DELETE Content-Type:text/csv http://lolcathost:9999/c body:a,b type:text/plain
+GET http://lolcathost:9999/d form:a=1 md5:5f189d8ec57f5a5a0d3dcba47fa797e2`
+	targets, err := NewTargets(strings.Split(src, "\n"), []byte("global"), nil)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+
+	for i, want := range [][2]string{
+		{`{"n": 1}`, "application/json"},
+		{"lolcat", "text/plain"},
+		{"a,b", "text/csv"},
+	} {
+		if body, ctype := requestBody(t, &targets[i]); string(body) != want[0] || ctype != want[1] {
+			t.Errorf("Target %d: want: %q, got: %q", i, want, [2]string{string(body), ctype})
+		}
+	}
+	if body, ctype := requestBody(t, &targets[3]); !strings.HasPrefix(ctype, "multipart/form-data") || !strings.Contains(string(body), `name="a"`) {
+		t.Errorf("Wrong form body of a GET target: %s", ctype)
+	}
+}
+
+func TestNewTargetsErrors(t *testing.T) {
+	t.Parallel()
+
+	for src, want := range map[string]string{
+		"GET":                                 "line 1: missing URL",
+		"\nGET X-Src:httpd":                   "line 2: missing URL",
+		"GET X-A:1 /path":                     "line 1: invalid header or URL `/path`",
+		"GET nope http://a/":                  "line 1: invalid header or URL `nope`",
+		"GET Authorization: Bearer http://a/": "line 1: header `Authorization` has no value",
+		"GET http://a/ lolcat":                "line 1: unexpected `lolcat` after the URL",
+		"GET http://a/ md5:lolcat":            "line 1: invalid md5 `lolcat`",
+		"POST http://a/ @a @b":                "line 1: unexpected `@b`, the target already has a body",
+		"POST http://a/ @a form:b=1":          "line 1: unexpected `form:b=1`, the target already has a body",
+		"POST http://a/ form:b=@":             "line 1: form part `b` has no file",
+		"PUT http://a/ body:a @b":             "line 1: unexpected `@b`, the target already has a body",
+		"PUT http://a/ type:":                 "line 1: missing content type",
+		"PUT http://a/ form:a=1 type:a/b":     "line 1: multipart forms have their own content type",
+		"PUT http://a/ b":                     "line 1: unexpected `b` after the URL",
+		"GET http://a/ timeout:soon":          "line 1: invalid timeout `soon`",
+		"GET http://a/ redirects:-1":          "line 1: invalid redirects `-1`",
+		"GET http://a/ proxy:ftp://b/":        "line 1: proxy `ftp://b/` is invalid",
+		"GET http://a/ retry:x":               "line 1: retry count `x` is invalid",
+		"POST http://a/ form:b=@c;size=1":     "line 1: invalid option `size=1` of form part `b`",
+		"GET \"http://a/":                     "line 1: unterminated double quote",
+		"lolcat":                              "line 1: unexpected `lolcat`, expected a request line",
+		"GET http://a/\nnot a header":         "line 2: invalid header `not a header`",
+		"POST http://a/ @a\n\nbody":           "line 3: inline body of a target which already has a body",
+		"GET http://a/\n\nbody\n\nmore":       "line 5: unexpected `more`, expected a request line",
+		"# comment\nGET http://a/{{nope}}":    "line 2: template:",
+		`{"url": "http://lolcathost:9999/"}`:  "line 1: unexpected",
+	} {
+		_, err := NewTargets(strings.Split(src, "\n"), nil, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("`%s`: want error: %s, got: %v", src, want, err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package stress
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// payload is a request body prepared out of a body file or a multipart form.
+// It is either held in memory or, when it doesn't fit in memory, streamed
+// out of its parts on every request.
+type payload struct {
+	data  []byte
+	tmpl  *template.Template
+	ctype string
+	err   error
+
+	parts []segment
+	size  int64
+
+	sumOnce sync.Once
+	sum     string
+	sumErr  error
+}
+
+// segment is a part of a streamed payload: either data held in memory, the
+// content of a file or synthetic content
+type segment struct {
+	data  []byte
+	path  string
+	synth *Synthetic
+}
+
+// DefaultBodyCache is the default memory budget, in bytes, of the request
+// bodies preloaded by Targets.Preload
+const DefaultBodyCache int64 = 256 << 20
+
+// Preload prepares the request bodies of all Targets once: body files are
+// read, templates are parsed and multipart forms are built up front so that
+// requests are sent straight out of memory. Bodies which don't fit in the
+// remaining budget, in bytes, are streamed from disk on every request
+// instead. Templated body files, see Target.TemplateFile, must fit in the
+// budget and are still rendered for every request. Files used by several
+// Targets are loaded once.
+func (t Targets) Preload(budget int64) error {
+	cache := map[string]*payload{}
+	for i := range t {
+		key := t[i].payloadKey()
+		if key == "" {
+			continue
+		}
+		p, ok := cache[key]
+		if !ok {
+			var err error
+			if p, err = newPayload(&t[i], &budget); err != nil {
+				return err
+			}
+			cache[key] = p
+		}
+		t[i].payload = p
+	}
+	return nil
+}
+
+// payloadKey returns the body file or form of the Target which needs a
+// payload, or an empty string if it needs none
+func (t *Target) payloadKey() string {
+	switch {
+	case len(t.Form) > 0:
+		return fmt.Sprintf("form:%q", t.Form)
+	case t.BodyFile != "" && t.TemplateFile:
+		return "template@" + t.BodyFile
+	case t.BodyFile != "":
+		return "@" + t.BodyFile
+	case t.Method == "POST" && t.File != "":
+		if strings.HasPrefix(t.File, "form:") {
+			return t.File
+		}
+		if t.TemplateFile {
+			return "template@" + t.File
+		}
+		return "@" + t.File
+	}
+	return ""
+}
+
+// newPayload prepares the payload of the Target, charging the size of in
+// memory payloads to budget.
+func newPayload(t *Target, budget *int64) (*payload, error) {
+	form, err := t.formParts()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &payload{}
+	if form != nil {
+		if err = p.buildForm(form); err != nil {
+			return nil, err
+		}
+	} else if t.BodyFile != "" {
+		p.parts = []segment{{path: t.BodyFile}}
+	} else {
+		p.parts = []segment{{path: t.File}}
+	}
+
+	synthetic := false
+	for _, s := range p.parts {
+		switch {
+		case s.synth != nil:
+			synthetic = true
+			continue
+		case s.path == "":
+			p.size += int64(len(s.data))
+			continue
+		}
+		fi, err := os.Stat(s.path)
+		if err != nil {
+			return nil, fmt.Errorf("Body file: "+"(%s): %s", s.path, err)
+		}
+		p.size += fi.Size()
+	}
+	templated := form == nil && t.TemplateFile
+	if templated && p.size > *budget {
+		return nil, fmt.Errorf("Body file: "+"(%s): templated body of %d bytes doesn't fit in the memory budget",
+			p.parts[0].path, p.size)
+	}
+	// Synthetic content is generated for every request, its size not
+	// being part of p.size
+	if synthetic || p.size > *budget {
+		return p, nil
+	}
+
+	p.data = make([]byte, 0, p.size)
+	for _, s := range p.parts {
+		if s.path == "" {
+			p.data = append(p.data, s.data...)
+			continue
+		}
+		body, err := ioutil.ReadFile(s.path)
+		if err != nil {
+			return nil, fmt.Errorf("Body file: "+"(%s): %s", s.path, err)
+		}
+		p.data = append(p.data, body...)
+	}
+	*budget -= p.size
+	filename := p.parts[0].path
+	p.parts = nil
+	// Binary files are sent as they are, templates or not
+	if templated && isTemplateBody(p.data) {
+		if p.tmpl, err = parseTemplate(filename, string(p.data)); err != nil {
+			return nil, fmt.Errorf("Body file: "+"(%s): %s", filename, err)
+		}
+		p.data = nil
+	}
+	return p, nil
+}
+
+// buildForm lays out the multipart form made of parts as the segments of
+// the payload, files being left to read.
+func (p *payload) buildForm(parts []FormPart) error {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for i := range parts {
+		if _, err := w.CreatePart(parts[i].header()); err != nil {
+			return err
+		}
+		if parts[i].File == "" && parts[i].Synthetic == nil {
+			buf.WriteString(parts[i].Value)
+			continue
+		}
+		p.parts = append(p.parts, segment{data: append([]byte(nil), buf.Bytes()...)},
+			segment{path: parts[i].File, synth: parts[i].Synthetic})
+		buf.Reset()
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	p.parts = append(p.parts, segment{data: buf.Bytes()})
+	p.ctype = w.FormDataContentType()
+	return nil
+}
+
+// open returns the body of the next request out of the payload along with
+// its length, rendering it with data if it is a template. Streamed bodies
+// are returned as an io.ReadCloser which must be closed.
+func (p *payload) open(data *templateData) (io.Reader, int64, error) {
+	switch {
+	case p.err != nil:
+		return nil, 0, p.err
+	case p.tmpl != nil:
+		body, err := render(p.tmpl, data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Body file: "+"(%s): %s", p.tmpl.Name(), err)
+		}
+		return bytes.NewReader(body), int64(len(body)), nil
+	case p.parts != nil:
+		readers := make([]io.Reader, len(p.parts))
+		size := p.size
+		var fds files
+		for i, s := range p.parts {
+			switch {
+			case s.synth != nil:
+				var n int64
+				readers[i], n = s.synth.open()
+				size += n
+				continue
+			case s.path == "":
+				readers[i] = bytes.NewReader(s.data)
+				continue
+			}
+			fd, err := os.Open(s.path)
+			if err != nil {
+				fds.Close()
+				return nil, 0, fmt.Errorf("Body file: "+"(%s): %s", s.path, err)
+			}
+			fds, readers[i] = append(fds, fd), fd
+		}
+		return readCloser{io.MultiReader(readers...), fds}, size, nil
+	}
+	return bytes.NewReader(p.data), int64(len(p.data)), nil
+}
+
+// hashable reports whether the payload is streamed out of files and data
+// only, which are the same for every request
+func (p *payload) hashable() bool {
+	if p.err != nil || p.parts == nil {
+		return false
+	}
+	for _, s := range p.parts {
+		if s.synth != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// sha256 returns the hex encoded SHA-256 hash of a hashable payload, which
+// is read once however many requests are signed
+func (p *payload) sha256() (string, error) {
+	p.sumOnce.Do(func() {
+		r, _, err := p.open(nil)
+		if err != nil {
+			p.sumErr = err
+			return
+		}
+		defer r.(io.Closer).Close()
+		h := sha256.New()
+		if _, err = io.Copy(h, r); err != nil {
+			p.sumErr = err
+			return
+		}
+		p.sum = hex.EncodeToString(h.Sum(nil))
+	})
+	return p.sum, p.sumErr
+}
+
+// readCloser binds a Reader to the Closer of its underlying resource
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// files closes a set of files at once
+type files []*os.File
+
+func (fs files) Close() error {
+	var err error
+	for _, fd := range fs {
+		if e := fd.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
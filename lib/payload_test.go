@@ -0,0 +1,187 @@
+package stress
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"os"
+	"strings"
+	"testing"
+)
+
+// tempFile writes content to a new temporary file and returns its name
+func tempFile(t testing.TB, content []byte) string {
+	f, err := ioutil.TempFile("", "stress-payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+// requestBody builds a request out of tgt and returns its body and content type
+func requestBody(t testing.TB, tgt *Target) ([]byte, string) {
+	req, err := tgt.Request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body.Close()
+	if int64(len(body)) != req.ContentLength {
+		t.Fatalf("Wrong content length. Want: %d, Got: %d", len(body), req.ContentLength)
+	}
+	return body, req.Header.Get("Content-Type")
+}
+
+func TestPreload(t *testing.T) {
+	t.Parallel()
+
+	name := tempFile(t, []byte("lolcat"))
+	defer os.Remove(name)
+
+	targets := Targets{
+		{Method: "PUT", URL: "http://lolcathost:9999/", BodyFile: name},
+		{Method: "POST", URL: "http://lolcathost:9999/", File: name},
+	}
+	if err := targets.Preload(DefaultBodyCache); err != nil {
+		t.Fatal(err)
+	}
+	if targets[0].payload == nil || targets[0].payload != targets[1].payload {
+		t.Fatal("Targets sharing a body file should share its payload")
+	}
+
+	if err := ioutil.WriteFile(name, []byte("changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := range targets {
+		if body, _ := requestBody(t, &targets[i]); string(body) != "lolcat" {
+			t.Errorf("Preloaded body shouldn't be read again. Got: %s", body)
+		}
+	}
+
+	if err := (Targets{{Method: "PUT", URL: "http://lolcathost:9999/", BodyFile: name + ".nope"}}).Preload(0); err == nil {
+		t.Error("Missing body files should fail to preload")
+	}
+}
+
+func TestPreloadBudget(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("lolcat"), 1024)
+	name := tempFile(t, content)
+	defer os.Remove(name)
+
+	for _, budget := range []int64{0, DefaultBodyCache} {
+		targets := Targets{{Method: "POST", URL: "http://lolcathost:9999/", File: "form:image:" + name}}
+		if err := targets.Preload(budget); err != nil {
+			t.Fatal(err)
+		}
+		if streamed := targets[0].payload.parts != nil; streamed != (budget == 0) {
+			t.Fatalf("Budget %d: want streamed: %t, got: %t", budget, budget == 0, streamed)
+		}
+
+		body, ctype := requestBody(t, &targets[0])
+		_, params, err := mime.ParseMediaType(ctype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(part)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		if part.FormName() != "image" || !bytes.Equal(got, content) {
+			t.Errorf("Budget %d: wrong form part %s", budget, part.FormName())
+		}
+	}
+}
+
+func TestPreloadTemplate(t *testing.T) {
+	t.Parallel()
+
+	name := tempFile(t, []byte(`{"n": {{.Seq}}}`))
+	defer os.Remove(name)
+
+	targets, err := NewTargets([]string{"PUT http://lolcathost:9999/ @" + name, "PUT http://lolcathost:9999/ @" + name}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the files told to are templates
+	targets[0].TemplateFile = true
+	if err = targets.Preload(DefaultBodyCache); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`{"n": 1}`, `{"n": 2}`} {
+		if body, _ := requestBody(t, &targets[0]); string(body) != want {
+			t.Errorf("Wrong body. Want: %s, Got: %s", want, body)
+		}
+	}
+	if body, _ := requestBody(t, &targets[1]); string(body) != `{"n": {{.Seq}}}` {
+		t.Errorf("Body files shouldn't be templates unless told so: %s", body)
+	}
+
+	targets.TemplateFiles()
+	if err = targets.Preload(4); err == nil || !strings.Contains(err.Error(), "doesn't fit") {
+		t.Errorf("Templated files should fit in the budget: %v", err)
+	}
+}
+
+func TestPrepared(t *testing.T) {
+	t.Parallel()
+
+	name := tempFile(t, []byte("lolcat"))
+	targets := Targets{
+		{Method: "PUT", URL: "http://lolcathost:9999/", BodyFile: name},
+		{Method: "PUT", URL: "http://lolcathost:9999/", BodyFile: name + ".nope"},
+	}
+	prep := targets.prepared()
+	os.Remove(name)
+
+	if targets[0].payload != nil || prep[0].payload == nil {
+		t.Fatal("The payloads should be prepared on a copy of the targets")
+	}
+	// Removing the file doesn't matter anymore
+	if body, _ := requestBody(t, &prep[0]); string(body) != "lolcat" {
+		t.Errorf("Wrong body: %s", body)
+	}
+	if _, err := prep[1].Request(); err == nil {
+		t.Error("Requests out of a payload which couldn't be prepared should fail")
+	}
+	if again := prep.prepared(); &again[0] != &prep[0] {
+		t.Error("Prepared targets shouldn't be copied again")
+	}
+}
+
+func BenchmarkFormRequest(b *testing.B) {
+	name := tempFile(b, bytes.Repeat([]byte{0xff}, 1<<20))
+	defer os.Remove(name)
+
+	for _, preload := range []bool{false, true} {
+		targets := Targets{{Method: "POST", URL: "http://lolcathost:9999/", File: "form:" + name}}
+		if preload {
+			if err := targets.Preload(DefaultBodyCache); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.Run(map[bool]string{false: "Disk", true: "Preloaded"}[preload], func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				req, err := targets[0].Request()
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(ioutil.Discard, req.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package stress
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bmizerany/perks/quantile"
+)
+
+// Progress is a snapshot of a running attack. Elapsed is the time since it
+// started and Remaining the time it has left, which is estimated out of the
+// rate results come back at in concurrency mode. Requests counts the
+// requests sent out of the Total planned, retries included, Results the
+// ones which came back and InFlight the ones awaited. Rate is the number
+// of requests sent per second since the start.
+//
+// Success, P50, P99 and Errors cover the results which came back within
+// the last Interval only: the ratio of successful requests, the 50th and
+// 99th latency percentiles and the number of failed requests. Done tells
+// that the attack is over, on the last Progress, and Paused that it is
+// paused.
+//
+// Metrics are the ones of all the results which came back so far, computed
+// incrementally, with the number of results failed with each error in
+// ErrorCounts. Targets holds the Metrics of every attacked Target, in the
+// order of the Targets, nil for the ones no result came back from yet.
+type Progress struct {
+	Elapsed   time.Duration
+	Remaining time.Duration
+	Requests  uint64
+	Total     uint64
+	Results   uint64
+	InFlight  uint64
+	Rate      float64
+	Interval  time.Duration
+	Success   float64
+	P50       time.Duration
+	P99       time.Duration
+	Errors    uint64
+	Done      bool
+	Paused    bool
+
+	Metrics     *Metrics
+	ErrorCounts map[string]int
+	Targets     []*Metrics
+}
+
+// SetProgress sets the function handed a Progress of every attack each
+// interval, and once more when it is over, in place of the ones set or
+// added before. It is called out of the goroutine gathering the results,
+// which it holds up until it returns. A nil function or a zero interval
+// disables it.
+func (a *Attacker) SetProgress(interval time.Duration, fn func(Progress)) {
+	a.progress = nil
+	a.AddProgress(interval, fn)
+}
+
+// AddProgress adds a function handed a Progress of every attack each
+// interval, like SetProgress, along with the ones already set or added.
+// The interval stats of a Progress cover the interval of its function.
+func (a *Attacker) AddProgress(interval time.Duration, fn func(Progress)) {
+	if fn != nil && interval > 0 {
+		a.progress = append(a.progress, progressFunc{interval, fn})
+	}
+}
+
+// progressFunc is a function handed a Progress every interval
+type progressFunc struct {
+	interval time.Duration
+	fn       func(Progress)
+}
+
+// progressMeter computes the Progress of an attack incrementally out of its
+// results as they come in, for every function handed one. It ticks every
+// shortest interval of them.
+type progressMeter struct {
+	at       *attack
+	every    time.Duration
+	results  uint64
+	all      *Aggregator
+	targets  []*Aggregator
+	watchers []*progressWatcher
+}
+
+// progressWatcher holds the stats of the current interval of a function
+// handed a Progress
+type progressWatcher struct {
+	progressFunc
+	last    time.Time
+	count   uint64
+	success uint64
+	quants  *quantile.Stream
+}
+
+func newProgressMeter(at *attack, funcs []progressFunc) *progressMeter {
+	m := &progressMeter{at: at, all: NewAggregator()}
+	for _, f := range funcs {
+		if m.every == 0 || f.interval < m.every {
+			m.every = f.interval
+		}
+		m.watchers = append(m.watchers, &progressWatcher{
+			progressFunc: f,
+			last:         at.start,
+			quants:       quantile.NewTargeted(0.50, 0.99),
+		})
+	}
+	return m
+}
+
+// add adds the result res to the current intervals and to the Metrics
+func (m *progressMeter) add(res Result) {
+	m.results++
+	success := res.Success()
+	for _, w := range m.watchers {
+		w.count++
+		if success {
+			w.success++
+		}
+		w.quants.Insert(float64(res.Latency))
+	}
+
+	m.all.Add(res)
+	for len(m.targets) <= res.target {
+		m.targets = append(m.targets, nil)
+	}
+	if m.targets[res.target] == nil {
+		m.targets[res.target] = NewAggregator()
+	}
+	m.targets[res.target].Add(res)
+}
+
+// tick hands a Progress to the functions whose interval is over at now
+func (m *progressMeter) tick(now time.Time) {
+	for _, w := range m.watchers {
+		// Ticks come every shortest interval, give or take
+		if now.Sub(w.last) >= w.interval-m.every/2 {
+			w.fn(m.snapshot(w, now))
+		}
+	}
+}
+
+// done hands the last Progress of the attack to every function
+func (m *progressMeter) done(now time.Time) {
+	for _, w := range m.watchers {
+		p := m.snapshot(w, now)
+		p.Done = true
+		w.fn(p)
+	}
+}
+
+// snapshot returns the Progress at now for w and starts its new interval
+func (m *progressMeter) snapshot(w *progressWatcher, now time.Time) Progress {
+	p := Progress{
+		Elapsed:  now.Sub(m.at.start),
+		Requests: atomic.LoadUint64(&m.at.sent),
+		Total:    uint64(m.at.planned()),
+		Results:  m.results,
+		Interval: now.Sub(w.last),
+		Errors:   w.count - w.success,
+		Paused:   m.at.isPaused(),
+
+		Metrics:     m.all.Metrics(),
+		ErrorCounts: m.all.ErrorCounts(),
+		Targets:     make([]*Metrics, len(m.targets)),
+	}
+	for i, g := range m.targets {
+		if g != nil {
+			p.Targets[i] = g.Metrics()
+		}
+	}
+	if p.Requests > p.Results {
+		p.InFlight = p.Requests - p.Results
+	}
+	if secs := p.Elapsed.Seconds(); secs > 0 {
+		p.Rate = float64(p.Requests) / secs
+	}
+	switch {
+	case m.at.duration > 0:
+		p.Remaining = m.at.duration - m.at.active(now)
+	case p.Results > 0 && p.Total > p.Results:
+		p.Remaining = time.Duration(float64(p.Elapsed) / float64(p.Results) * float64(p.Total-p.Results))
+	}
+	if p.Remaining < 0 {
+		p.Remaining = 0
+	}
+	if w.count > 0 {
+		p.Success = float64(w.success) / float64(w.count)
+		p.P50 = time.Duration(w.quants.Query(0.50))
+		p.P99 = time.Duration(w.quants.Query(0.99))
+	}
+
+	w.last, w.count, w.success = now, 0, 0
+	w.quants.Reset()
+	return p
+}
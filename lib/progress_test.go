@@ -0,0 +1,132 @@
+package stress
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fail" {
+				w.WriteHeader(500)
+			}
+		}),
+	)
+
+	var mu sync.Mutex
+	var progress []Progress
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.SetProgress(100*time.Millisecond, func(p Progress) {
+		mu.Lock()
+		progress = append(progress, p)
+		mu.Unlock()
+	})
+	tgts := Targets{{Method: "GET", URL: server.URL}, {Method: "GET", URL: server.URL + "/fail"}}
+	results := atk.AttackRate(tgts, 100, 1*time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(progress) < 5 {
+		t.Fatalf("Too few progress snapshots: %d", len(progress))
+	}
+	last := progress[len(progress)-1]
+	if !last.Done || last.Requests != 100 || last.Results != uint64(len(results)) || last.InFlight != 0 {
+		t.Errorf("Wrong last progress: %+v", last)
+	}
+
+	var errors uint64
+	for i, p := range progress {
+		errors += p.Errors
+		if i > 0 && p.Elapsed < progress[i-1].Elapsed {
+			t.Errorf("Snapshot %d went back in time: %+v", i, p)
+		}
+		if !p.Done && p.Total != 100 {
+			t.Errorf("Snapshot %d: wrong total: %+v", i, p)
+		}
+		if p.Results > 0 && p.Remaining > time.Second {
+			t.Errorf("Snapshot %d: wrong remaining time: %+v", i, p)
+		}
+		// Half the requests fail in every interval
+		if p.Requests > 20 && p.Interval >= 50*time.Millisecond && (p.Success < 0.2 || p.Success > 0.8) {
+			t.Errorf("Snapshot %d: wrong success ratio: %+v", i, p)
+		}
+	}
+	if errors != 50 {
+		t.Errorf("Wrong number of errors over all intervals. Want: 50, Got: %d", errors)
+	}
+
+	// Metrics are the ones of the whole attack, and of every Target
+	if m := last.Metrics; m.Requests != 100 || m.Success != 0.5 || m.StatusCodes["500"] != 50 {
+		t.Errorf("Wrong metrics: %+v", m)
+	}
+	if len(last.Targets) != 2 || last.Targets[0].Success != 1 || last.Targets[1].Success != 0 {
+		t.Errorf("Wrong targets metrics: %+v", last.Targets)
+	}
+	if n := last.ErrorCounts["GET "+server.URL+"/fail: 500 Internal Server Error"]; n != 50 {
+		t.Errorf("Wrong error counts: %v", last.ErrorCounts)
+	}
+}
+
+func TestProgressMeter(t *testing.T) {
+	t.Parallel()
+
+	at := newAttack(10, 0)
+	m := newProgressMeter(at, []progressFunc{{time.Second, nil}})
+	w := m.watchers[0]
+	at.sent = 6
+	for _, code := range []uint16{200, 200, 200, 500} {
+		m.add(Result{Code: code, Latency: time.Duration(code) * time.Millisecond})
+	}
+
+	p := m.snapshot(w, at.start.Add(2*time.Second))
+	if p.Results != 4 || p.InFlight != 2 || p.Errors != 1 || p.Success != 0.75 || p.Rate != 3 {
+		t.Errorf("Wrong progress: %+v", p)
+	}
+	// 6 results left at 2 per second
+	if p.Remaining != 3*time.Second {
+		t.Errorf("Wrong remaining time. Want: 3s, Got: %s", p.Remaining)
+	}
+	// Percentiles are estimated
+	if p.P50 != 200*time.Millisecond || p.P99 < p.P50 {
+		t.Errorf("Wrong percentiles: %s, %s", p.P50, p.P99)
+	}
+
+	// Intervals start over
+	p = m.snapshot(w, at.start.Add(3*time.Second))
+	if p.Interval != time.Second || p.Errors != 0 || p.Success != 0 || p.P99 != 0 || p.Results != 4 {
+		t.Errorf("Wrong progress: %+v", p)
+	}
+}
+
+func TestAddProgress(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+	)
+
+	var fast, slow []Progress
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.SetProgress(50*time.Millisecond, func(p Progress) { fast = append(fast, p) })
+	atk.AddProgress(250*time.Millisecond, func(p Progress) { slow = append(slow, p) })
+	atk.AttackRate(Targets{{Method: "GET", URL: server.URL}}, 100, 1*time.Second)
+
+	if len(fast) < 10 || len(slow) < 3 || len(slow) > 6 {
+		t.Fatalf("Wrong number of snapshots: %d fast, %d slow", len(fast), len(slow))
+	}
+	// Every function is handed the last snapshot, and intervals of its own
+	for _, ps := range [][]Progress{fast, slow} {
+		if last := ps[len(ps)-1]; !last.Done || last.Results != 100 {
+			t.Errorf("Wrong last progress: %+v", last)
+		}
+	}
+	if i := slow[1].Interval; i < 200*time.Millisecond || i > 300*time.Millisecond {
+		t.Errorf("Wrong slow interval: %s", i)
+	}
+}
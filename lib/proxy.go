@@ -0,0 +1,165 @@
+package stress
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NoProxy is the proxy of the Targets sent straight to their host, whatever
+// the proxy of the Attacker
+const NoProxy = "direct"
+
+// ParseProxy parses the URL of a proxy like http://host:port for HTTP
+// proxies, tunneling https requests with CONNECT, or socks5://host:port for
+// SOCKS5 proxies. Credentials are given as user:password@ in the URL. It
+// returns nil for NoProxy.
+func ParseProxy(proxy string) (*url.URL, error) {
+	if proxy == NoProxy {
+		return nil, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy `%s` is invalid, use http, https or socks5", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy `%s` has no host", proxy)
+	}
+	return u, nil
+}
+
+// SetProxy sets the function returning the proxy requests are sent through,
+// like http.ProxyURL, unless their Target tells otherwise. A nil function
+// falls back to http.ProxyFromEnvironment.
+func (a *Attacker) SetProxy(proxy func(*http.Request) (*url.URL, error)) { a.proxy = proxy }
+
+// proxyKey is the context key of the targetProxy of a Target
+type proxyKey struct{}
+
+// targetProxy is the Proxy of a Target once parsed: its URL, nil for
+// NoProxy, or the error parsing it
+type targetProxy struct {
+	url *url.URL
+	err error
+}
+
+// parseProxy parses the Proxy of the Target once for all its requests
+func (t *Target) parseProxy() error {
+	u, err := ParseProxy(t.Proxy)
+	t.proxy = &targetProxy{u, err}
+	return err
+}
+
+// phasesKey is the context key of the *phases of a request
+type phasesKey struct{}
+
+// proxyFor returns the proxy req is sent through and records in its phases,
+// if traced, whether its connection is set up with a proxy handshake: with
+// SOCKS5 proxies, or to tunnel https requests through HTTP proxies. Plain
+// http requests are sent to HTTP proxies without any.
+func (a *Attacker) proxyFor(req *http.Request) (u *url.URL, err error) {
+	if tp, ok := req.Context().Value(proxyKey{}).(targetProxy); ok {
+		u = tp.url
+	} else if a.proxy != nil {
+		u, err = a.proxy(req)
+	} else {
+		u, err = http.ProxyFromEnvironment(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := req.Context().Value(phasesKey{}).(*phases); ok {
+		p.mu.Lock()
+		p.handshake = u != nil && (strings.HasPrefix(u.Scheme, "socks5") || req.URL.Scheme == "https")
+		p.mu.Unlock()
+	}
+	return u, nil
+}
+
+// phases times the setup of the connection a request is sent over and
+// counts the bytes of the request on the wire
+type phases struct {
+	conns   *sync.Map
+	wireIn  int64
+	wireOut int64
+
+	mu        sync.Mutex
+	handshake bool
+	getConn   time.Time
+	dialed    time.Time
+	tlsStart  time.Time
+	tls       time.Duration
+	setup     time.Duration
+}
+
+// trace returns ctx tracing the connection setup into p
+func (p *phases) trace(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, phasesKey{}, p)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			p.mu.Lock()
+			p.getConn = time.Now()
+			p.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			p.mu.Lock()
+			if err == nil {
+				p.dialed = time.Now()
+			}
+			p.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			p.mu.Lock()
+			p.tlsStart = time.Now()
+			p.mu.Unlock()
+		},
+		// Requests tunneled through https proxies shake hands twice
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.mu.Lock()
+			p.tls += time.Since(p.tlsStart)
+			p.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if c, ok := wireConnOf(p.conns, info.Conn); ok {
+				c.carry(p)
+			}
+			p.mu.Lock()
+			if !info.Reused {
+				p.setup = time.Since(p.getConn)
+			}
+			p.mu.Unlock()
+		},
+	})
+}
+
+// record sets the phases of res: dialing, the proxy handshake, which is
+// whatever the setup took but dialing and TLS, and the TLS handshake
+func (p *phases) record(res *Result) {
+	res.WireIn = uint64(atomic.LoadInt64(&p.wireIn))
+	res.WireOut = uint64(atomic.LoadInt64(&p.wireOut))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.setup == 0 || p.dialed.IsZero() {
+		return
+	}
+	res.Connect = p.dialed.Sub(p.getConn)
+	res.TLS = p.tls
+	if p.handshake {
+		if res.Proxy = p.setup - res.Connect - res.TLS; res.Proxy < 0 {
+			res.Proxy = 0
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"html"
 	"strconv"
 	"text/tabwriter"
 )
@@ -15,26 +16,81 @@ type Reporter func([]Result) ([]byte, error)
 
 // ReportText returns a computed Metrics struct as aligned, formatted text
 func ReportText(results []Result) ([]byte, error) {
-	m := NewMetrics(results)
+	return TextReporter(nil)(results)
+}
+
+// TextReporter returns a Reporter like ReportText which also tells whether
+// the Thresholds passed
+func TextReporter(th Thresholds) Reporter {
+	return func(results []Result) ([]byte, error) {
+		m := NewMetrics(results)
+		if len(th) > 0 {
+			th.Check(m)
+		}
+		return reportText(m)
+	}
+}
+
+func reportText(m *Metrics) ([]byte, error) {
 	out := &bytes.Buffer{}
 
 	w := tabwriter.NewWriter(out, 0, 8, 2, '\t', tabwriter.StripEscape)
 	fmt.Fprintf(w, "Requests\t[total]\t%d\n", m.Requests)
+	if m.Stopped != "" {
+		fmt.Fprintf(w, "Stopped\t[reason]\t%s\n", m.Stopped)
+	}
 	fmt.Fprintf(w, "Duration\t[total]\t%s\n", m.Duration)
 	fmt.Fprintf(w, "QPS\t[mean]\t%f\n", m.QPS)
 	fmt.Fprintf(w, "Latencies\t[mean, 50, 95, 99, max]\t%s, %s, %s, %s, %s\n",
 		m.Latencies.Mean, m.Latencies.P50, m.Latencies.P95, m.Latencies.P99, m.Latencies.Max)
 	fmt.Fprintf(w, "Bytes In\t[total, mean]\t%d, %.2f\n", m.BytesIn.Total, m.BytesIn.Mean)
+	if len(m.Encodings) > 0 && m.BytesIn.Total > 0 {
+		fmt.Fprintf(w, "Bytes In Encoded\t[total, ratio]\t%d, %.2f%%\n",
+			m.BytesIn.Encoded, float64(m.BytesIn.Encoded)/float64(m.BytesIn.Total)*100)
+	}
 	fmt.Fprintf(w, "Bytes Out\t[total, mean]\t%d, %.2f\n", m.BytesOut.Total, m.BytesOut.Mean)
+	if m.WireIn.Total > 0 || m.WireOut.Total > 0 {
+		fmt.Fprintf(w, "Wire In\t[total, mean]\t%d, %.2f\n", m.WireIn.Total, m.WireIn.Mean)
+		fmt.Fprintf(w, "Wire Out\t[total, mean]\t%d, %.2f\n", m.WireOut.Total, m.WireOut.Mean)
+	}
 	fmt.Fprintf(w, "Success\t[ratio]\t%.2f%%\n", m.Success*100)
+	if m.Attempts.Retries > 0 {
+		fmt.Fprintf(w, "Attempts\t[retries, first success, eventual success]\t%d, %.2f%%, %.2f%%\n",
+			m.Attempts.Retries, m.Attempts.FirstSuccess*100, m.Attempts.EventualSuccess*100)
+	}
+	if m.Phases.Proxies > 0 {
+		fmt.Fprintf(w, "Connections\t[total, connect, proxy, tls]\t%d, %s, %s, %s\n",
+			m.Phases.Connections, m.Phases.Connect, m.Phases.Proxy, m.Phases.TLS)
+	} else if m.Phases.Connections > 0 {
+		fmt.Fprintf(w, "Connections\t[total, connect, tls]\t%d, %s, %s\n",
+			m.Phases.Connections, m.Phases.Connect, m.Phases.TLS)
+	}
 	fmt.Fprintf(w, "Status Codes\t[code:count]\t")
 	for code, count := range m.StatusCodes {
 		fmt.Fprintf(w, "%s:%d  ", code, count)
 	}
+	if len(m.Encodings) > 0 {
+		fmt.Fprintf(w, "\nEncodings\t[encoding:count]\t")
+		for enc, count := range m.Encodings {
+			fmt.Fprintf(w, "%s:%d  ", enc, count)
+		}
+	}
+	if len(m.Timeouts) > 0 {
+		fmt.Fprintf(w, "\nTimeouts\t[kind:count]\t")
+		for kind, count := range m.Timeouts {
+			fmt.Fprintf(w, "%s:%d  ", kind, count)
+		}
+	}
 	fmt.Fprintln(w, "\nError Set:")
 	for _, err := range m.Errors {
 		fmt.Fprintln(w, err)
 	}
+	if len(m.Thresholds) > 0 {
+		fmt.Fprintln(w, "Thresholds:")
+		for _, t := range m.Thresholds {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", passFail(t.Pass), t.Threshold, t.Actual)
+		}
+	}
 
 	if err := w.Flush(); err != nil {
 		return []byte{}, err
@@ -44,12 +100,55 @@ func ReportText(results []Result) ([]byte, error) {
 
 // ReportJSON writes a computed Metrics struct to as JSON
 func ReportJSON(results []Result) ([]byte, error) {
-	return json.Marshal(NewMetrics(results))
+	return JSONReporter(nil)(results)
+}
+
+// JSONReporter returns a Reporter like ReportJSON whose Metrics hold the
+// results of the Thresholds
+func JSONReporter(th Thresholds) Reporter {
+	return func(results []Result) ([]byte, error) {
+		m := NewMetrics(results)
+		if len(th) > 0 {
+			th.Check(m)
+		}
+		return json.Marshal(m)
+	}
 }
 
 // ReportPlot builds up a self contained HTML page with an interactive plot
 // of the latencies of the requests. Built with http://dygraphs.com/
 func ReportPlot(results []Result) ([]byte, error) {
+	return PlotReporter(nil)(results)
+}
+
+// PlotReporter returns a Reporter like ReportPlot which also lists whether
+// the Thresholds passed
+func PlotReporter(th Thresholds) Reporter {
+	return func(results []Result) ([]byte, error) {
+		thresholds := ""
+		if len(th) > 0 {
+			m := NewMetrics(results)
+			th.Check(m)
+			thresholds = "<ul id=\"thresholds\" style=\"font-family: Courier\">"
+			for _, t := range m.Thresholds {
+				thresholds += fmt.Sprintf("<li>%s %s (%s)</li>", passFail(t.Pass),
+					html.EscapeString(t.Threshold), html.EscapeString(t.Actual))
+			}
+			thresholds += "</ul>"
+		}
+		return reportPlot(results, thresholds)
+	}
+}
+
+// passFail returns PASS or FAIL
+func passFail(pass bool) string {
+	if pass {
+		return "PASS"
+	}
+	return "FAIL"
+}
+
+func reportPlot(results []Result, thresholds string) ([]byte, error) {
 	series := &bytes.Buffer{}
 	for i, point := 0, ""; i < len(results); i++ {
 		point = "[" + strconv.FormatFloat(
@@ -68,7 +167,7 @@ func ReportPlot(results []Result) ([]byte, error) {
 		series.Truncate(series.Len() - 1)
 	}
 
-	return []byte(fmt.Sprintf(plotsTemplate, dygraphJSLibSrc(), series)), nil
+	return []byte(fmt.Sprintf(plotsTemplate, thresholds, dygraphJSLibSrc(), series)), nil
 }
 
 const plotsTemplate = `<!doctype>
@@ -79,6 +178,7 @@ const plotsTemplate = `<!doctype>
 <body>
   <div id="latencies" style="font-family: Courier; width: 100%%; height: 600px"></div>
   <a href="#" download="stressplot.png" onclick="this.href = document.getElementsByTagName('canvas')[0].toDataURL('image/png').replace(/^data:image\/[^;]/, 'data:application/octet-stream')">Download as PNG</a>
+  %s
   <script>
 	%s
   </script>
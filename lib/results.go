@@ -1,6 +1,7 @@
 package stress
 
 import (
+	"bufio"
 	"encoding/json"
 	"io"
 	"sort"
@@ -16,6 +17,43 @@ type Result struct {
 	BytesOut  uint64
 	BytesIn   uint64
 	Error     string
+	// Attempt is the number of the attempt of the request, starting at 1
+	Attempt int
+	// Retried tells that the request was attempted again after this one
+	Retried bool
+	// Timeout is the kind of timeout the request failed with, if any
+	Timeout string
+	// Connect, Proxy and TLS time the setup of a new connection: dialing,
+	// the proxy if any, the proxy handshake and the TLS handshake. They
+	// are zero when the request reused a connection. Proxy is zero too for
+	// plain http requests through HTTP proxies, which need no handshake.
+	Connect time.Duration
+	Proxy   time.Duration
+	TLS     time.Duration
+	// Encoding is the content encoding of the response body, BytesIn
+	// counting its decoded bytes and BytesInEncoded the ones received
+	Encoding       string
+	BytesInEncoded uint64
+	// WireIn and WireOut count the bytes read and written on the connection
+	// for the request: status or request line, headers, bodies, TLS records
+	// and the setup of a new connection
+	WireIn  uint64
+	WireOut uint64
+	// Stopped tells why the attack was stopped early by its Breaker, on the
+	// result which tripped it
+	Stopped string
+	// Expected tells that the response had one of the status codes its
+	// Target expected and passed its assertions
+	Expected bool
+	// target is the index of the Target hit out of the attacked ones
+	target int
+}
+
+// Success reports whether the request succeeded without error: it got a 2xx
+// response, or one with a status code its Target expected, which passed its
+// assertions, and read its body whole
+func (r Result) Success() bool {
+	return r.Error == "" && (r.Code >= 200 && r.Code < 250 || r.Expected)
 }
 
 // Results is a slice of Result structs with encoding,
@@ -41,9 +79,72 @@ func (r Results) Encode(out io.Writer) error {
 }
 
 // Decode reads data from an io.Reader and decodes it into a Results struct
-// returning an error in case of failure
+// returning an error in case of failure. It reads both the JSON array
+// written by Encode and the stream of JSON lines written while attacking.
 func (r *Results) Decode(in io.Reader) error {
-	return json.NewDecoder(in).Decode(r)
+	d := NewDecoder(in)
+	results := Results{}
+	for {
+		var res Result
+		if err := d.Decode(&res); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 && !d.array {
+		return io.EOF
+	}
+	*r = results
+	return nil
+}
+
+// Decoder decodes Results one at a time, out of a JSON array of them or out
+// of a stream of JSON lines, so that they can be read as they are written
+type Decoder struct {
+	in      *bufio.Reader
+	dec     *json.Decoder
+	array   bool
+	started bool
+}
+
+// NewDecoder returns a new Decoder reading from in
+func NewDecoder(in io.Reader) *Decoder {
+	br := bufio.NewReader(in)
+	return &Decoder{in: br, dec: json.NewDecoder(br)}
+}
+
+// Decode decodes the next Result into res, returning io.EOF once there is
+// none left
+func (d *Decoder) Decode(res *Result) error {
+	if !d.started {
+		d.started = true
+		// Arrays are told apart from streams by their first byte
+		for {
+			b, err := d.in.ReadByte()
+			if err != nil {
+				return err
+			}
+			if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+				d.in.UnreadByte()
+				d.array = b == '['
+				break
+			}
+		}
+		if d.array {
+			if _, err := d.dec.Token(); err != nil {
+				return err
+			}
+		}
+	}
+	if d.array && !d.dec.More() {
+		if _, err := d.dec.Token(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	return d.dec.Decode(res)
 }
 
 // Sort sorts Results by Timestamp in ascending order and returns
@@ -2,7 +2,9 @@ package stress
 
 import (
 	"bytes"
+	"io"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -11,9 +13,9 @@ func TestEncoding(t *testing.T) {
 	t.Parallel()
 
 	results := Results{
-		Result{200, time.Now(), 100 * time.Millisecond, 10, 30, ""},
-		Result{200, time.Now(), 20 * time.Millisecond, 20, 20, ""},
-		Result{200, time.Now(), 30 * time.Millisecond, 30, 10, ""},
+		Result{Code: 200, Timestamp: time.Now(), Latency: 100 * time.Millisecond, BytesOut: 10, BytesIn: 30},
+		Result{Code: 200, Timestamp: time.Now(), Latency: 20 * time.Millisecond, BytesOut: 20, BytesIn: 20},
+		Result{Code: 200, Timestamp: time.Now(), Latency: 30 * time.Millisecond, BytesOut: 30, BytesIn: 10},
 	}
 	buffer := &bytes.Buffer{}
 
@@ -56,3 +58,36 @@ func TestSort(t *testing.T) {
 		t.Fatalf("Sort failed: %v", results)
 	}
 }
+
+func TestDecodeStream(t *testing.T) {
+	t.Parallel()
+
+	stream := "\n" + `{"Code":200,"BytesOut":10}` + "\n" + `{"Code":500,"BytesOut":20}` + "\n"
+	for _, tc := range []struct {
+		in    string
+		codes []uint16
+		err   error
+	}{
+		{stream, []uint16{200, 500}, nil},
+		{` [{"Code":200},{"Code":404}]`, []uint16{200, 404}, nil},
+		{"[]", nil, nil},
+		{"", nil, io.EOF},
+		{`{"Code":200}` + "\n" + `{"Code":`, nil, io.ErrUnexpectedEOF},
+	} {
+		var results Results
+		err := results.Decode(strings.NewReader(tc.in))
+		if err != tc.err {
+			t.Errorf("%q: wrong error. Want: %v, Got: %v", tc.in, tc.err, err)
+			continue
+		}
+		if len(results) != len(tc.codes) {
+			t.Errorf("%q: wrong results: %+v", tc.in, results)
+			continue
+		}
+		for i, code := range tc.codes {
+			if results[i].Code != code {
+				t.Errorf("%q: result %d: wrong code. Want: %d, Got: %d", tc.in, i, code, results[i].Code)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package stress
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NoRedirects is the Redirects value of a Target whose redirects are not
+// followed, the redirect response being its result
+const NoRedirects = -1
+
+// Retry is the retry policy of a Target. Every attempt is recorded as a
+// Result of its own.
+type Retry struct {
+	// Count is the maximum number of retries of a request
+	Count int
+	// Backoff is the delay before the first retry, doubled for every next
+	// one up to a minute
+	Backoff time.Duration
+	// Statuses are the response status codes which are retried
+	Statuses []int
+	// Errors retries the requests which failed without a response
+	Errors bool
+}
+
+// parseRetry parses a retry policy like COUNT[;backoff=D][;on=CONDITION,...]
+// where conditions are status codes, status classes like 5xx or error.
+// Requests failed without a response or with a 5xx status are retried when
+// no condition is given.
+func parseRetry(spec string) (Retry, error) {
+	opts := strings.Split(spec, ";")
+	count, err := strconv.Atoi(opts[0])
+	if err != nil || count < 0 {
+		return Retry{}, fmt.Errorf("retry count `%s` is invalid", opts[0])
+	}
+	r := Retry{Count: count}
+
+	var on []string
+	for _, opt := range opts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case len(kv) == 2 && kv[0] == "backoff":
+			if r.Backoff, err = time.ParseDuration(kv[1]); err != nil {
+				return Retry{}, fmt.Errorf("retry backoff `%s` is invalid", kv[1])
+			}
+		case len(kv) == 2 && kv[0] == "on":
+			on = strings.Split(kv[1], ",")
+		default:
+			return Retry{}, fmt.Errorf("retry option `%s` is invalid", opt)
+		}
+	}
+	return r, r.setConditions(on)
+}
+
+// setConditions sets what the policy retries out of a list of status codes,
+// status classes like 5xx and error. An empty list retries errors and 5xx.
+func (r *Retry) setConditions(on []string) error {
+	if len(on) == 0 {
+		on = []string{"error", "5xx"}
+	}
+	for _, cond := range on {
+		cond = strings.ToLower(strings.TrimSpace(cond))
+		switch {
+		case cond == "error":
+			r.Errors = true
+		case len(cond) == 3 && strings.HasSuffix(cond, "xx") && cond[0] >= '1' && cond[0] <= '5':
+			class := int(cond[0]-'0') * 100
+			for code := class; code < class+100; code++ {
+				r.Statuses = append(r.Statuses, code)
+			}
+		default:
+			code, err := strconv.Atoi(cond)
+			if err != nil || code < 100 || code > 599 {
+				return fmt.Errorf("retry condition `%s` is invalid", cond)
+			}
+			r.Statuses = append(r.Statuses, code)
+		}
+	}
+	return nil
+}
+
+// retries reports whether the policy retries a request which ended up
+// with res
+func (r *Retry) retries(res Result) bool {
+	if res.Code == 0 {
+		return r.Errors
+	}
+	for _, code := range r.Statuses {
+		if int(res.Code) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// maxBackoff bounds the delay before a retry
+const maxBackoff = time.Minute
+
+// backoff returns the delay before the retry following the nth attempt,
+// doubled until it reaches maxBackoff
+func (r *Retry) backoff(n int) time.Duration {
+	d := r.Backoff
+	if d <= 0 {
+		return 0
+	}
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
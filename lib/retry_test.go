@@ -0,0 +1,45 @@
+package stress
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetry(t *testing.T) {
+	t.Parallel()
+
+	r, err := parseRetry("3;backoff=100ms;on=429,5xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Count != 3 || r.Backoff != 100*time.Millisecond || r.Errors || len(r.Statuses) != 101 {
+		t.Errorf("Retry was parsed incorrectly: %+v", r)
+	}
+	for code, want := range map[uint16]bool{0: false, 200: false, 429: true, 500: true, 599: true} {
+		if got := r.retries(Result{Code: code}); got != want {
+			t.Errorf("Retry of status %d: want: %t, got: %t", code, want, got)
+		}
+	}
+	if got := r.backoff(3); got != 400*time.Millisecond {
+		t.Errorf("Wrong backoff. Want: 400ms, Got: %s", got)
+	}
+	// Backoffs never overflow past maxBackoff
+	for _, b := range []time.Duration{time.Second, 1 << 62, -time.Second} {
+		long := Retry{Backoff: b}
+		for _, n := range []int{1, 10, 64, 1000} {
+			if got := long.backoff(n); got < 0 || got > maxBackoff {
+				t.Errorf("Wrong backoff of %s after %d attempts: %s", b, n, got)
+			}
+		}
+	}
+
+	if r, err = parseRetry("2"); err != nil || !r.Errors || !r.retries(Result{Code: 502}) || r.retries(Result{Code: 404}) {
+		t.Errorf("Retries should default to errors and 5xx: %+v, %v", r, err)
+	}
+
+	for _, spec := range []string{"", "-1", "x", "1;backoff=soon", "1;on=6xx", "1;on=lolcat", "1;lolcat=1"} {
+		if _, err := parseRetry(spec); err == nil {
+			t.Errorf("`%s` shouldn't be valid", spec)
+		}
+	}
+}
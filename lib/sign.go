@@ -0,0 +1,237 @@
+package stress
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signer signs the requests built out of Targets, see Targets.Sign. Attacks
+// sign requests last, once they are authenticated and went through the
+// RequestHooks, right before they are sent.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// Sign sets the Signer of the requests built out of all Targets
+func (t Targets) Sign(s Signer) {
+	for i := range t {
+		t[i].signer = s
+	}
+}
+
+// errUnhashableBody tells that a request body can't be read twice to be
+// hashed, like bodies made of synthetic multipart form files
+var errUnhashableBody = errors.New("the body can't be hashed")
+
+// bodySumKey is the context key of the hex encoded SHA-256 hash of a
+// request body streamed from disk, hashed once by its Target
+type bodySumKey struct{}
+
+// bodySHA256 returns the hex encoded SHA-256 hash of the body of req
+func bodySHA256(req *http.Request) (string, error) {
+	if sum, ok := req.Context().Value(bodySumKey{}).(string); ok {
+		return sum, nil
+	}
+	h := sha256.New()
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return "", errUnhashableBody
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, body)
+		body.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HMACSigner signs requests with an HMAC-SHA256, keyed with Secret, of
+// their canonical form:
+//
+//	METHOD\nPATH[?QUERY]\nDATE\nHEX(SHA256(BODY))
+//
+// The Date header is set unless present, X-Content-Sha256 is set to the
+// body hash and Header, Authorization by default, to
+// "HMAC-SHA256 KeyId=<KeyID>, Signature=<base64 signature>".
+type HMACSigner struct {
+	KeyID  string
+	Secret string
+	Header string
+
+	now func() time.Time
+}
+
+// Sign signs req
+func (s *HMACSigner) Sign(req *http.Request) error {
+	sum, err := bodySHA256(req)
+	if err != nil {
+		return fmt.Errorf("HMAC: %s", err)
+	}
+	if req.Header.Get("Date") == "" {
+		req.Header.Set("Date", clock(s.now).UTC().Format(http.TimeFormat))
+	}
+	req.Header.Set("X-Content-Sha256", sum)
+
+	path := req.URL.EscapedPath()
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", req.Method, path, req.Header.Get("Date"), sum)
+
+	header := s.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	req.Header.Set(header, fmt.Sprintf("HMAC-SHA256 KeyId=%s, Signature=%s",
+		s.KeyID, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	return nil
+}
+
+// SigV4Signer signs requests with the AWS Signature Version 4, as expected
+// by S3 and compatible object stores. The bodies of S3 requests which can't
+// be hashed are sent as unsigned payloads.
+type SigV4Signer struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+	Service      string
+
+	now func() time.Time
+}
+
+// Sign signs req
+func (s *SigV4Signer) Sign(req *http.Request) error {
+	now := clock(s.now).UTC()
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+
+	sum, err := bodySHA256(req)
+	if err == errUnhashableBody && s.Service == "s3" {
+		sum, err = "UNSIGNED-PAYLOAD", nil
+	}
+	if err != nil {
+		return fmt.Errorf("SigV4: %s", err)
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", sum)
+	}
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-amz-") || k == "content-type" || k == "content-md5" {
+			headers[k] = strings.Join(strings.Fields(strings.Join(vs, ",")), " ")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	canonical := &strings.Builder{}
+	path := canonicalPath(req.URL, s.Service != "s3")
+	fmt.Fprintf(canonical, "%s\n%s\n%s\n", req.Method, path, canonicalQuery(req.URL.Query()))
+	for _, k := range names {
+		fmt.Fprintf(canonical, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+	fmt.Fprintf(canonical, "\n%s\n%s", signed, sum)
+
+	scope := strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+	hash := sha256.Sum256([]byte(canonical.String()))
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, s.Service, "aws4_request", toSign} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, hex.EncodeToString(key)))
+	return nil
+}
+
+// canonicalPath returns the SigV4 canonical form of the path of u, every
+// segment being URI encoded once, as S3 expects, or twice, as the other
+// services do.
+func canonicalPath(u *url.URL, twice bool) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segment = unescaped
+		}
+		segment = awsEscape(segment)
+		if twice {
+			segment = awsEscape(segment)
+		}
+		segments[i] = segment
+	}
+	if path := strings.Join(segments, "/"); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// canonicalQuery returns the SigV4 canonical form of a query string
+func canonicalQuery(q url.Values) string {
+	pairs := make([]string, 0, len(q))
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent encodes every byte of s but unreserved characters
+func awsEscape(s string) string {
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// clock returns the time told by now, or the current time if now is nil
+func clock(now func() time.Time) time.Time {
+	if now == nil {
+		return time.Now()
+	}
+	return now()
+}
@@ -0,0 +1,174 @@
+package stress
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigV4Signer(t *testing.T) {
+	t.Parallel()
+
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	s := &SigV4Signer{
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:    "us-east-1",
+		Service:   "service",
+		now:       func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+	if err := s.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Wrong authorization.\nWant: %s\nGot:  %s", want, got)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("Wrong X-Amz-Date: %s", got)
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	t.Parallel()
+
+	name := tempFile(t, []byte("lolcat"))
+	defer os.Remove(name)
+
+	targets, err := NewTargets([]string{
+		"PUT http://lolcathost:9999/a?b=c body:lolcat",
+		"PUT http://lolcathost:9999/a?b=c @" + name,
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bodies are streamed from disk
+	if err = targets.Preload(0); err != nil {
+		t.Fatal(err)
+	}
+	targets.Sign(&HMACSigner{
+		KeyID:  "goku",
+		Secret: "s3cr3t",
+		Header: "X-Signature",
+		now:    func() time.Time { return time.Unix(0, 0) },
+	})
+
+	sum := sha256.Sum256([]byte("lolcat"))
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	fmt.Fprintf(mac, "PUT\n/a?b=c\nThu, 01 Jan 1970 00:00:00 GMT\n%x", sum)
+	want := "HMAC-SHA256 KeyId=goku, Signature=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	for i := range targets {
+		req, err := targets[i].Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("X-Signature"); got != want {
+			t.Errorf("Target %d: wrong signature.\nWant: %s\nGot:  %s", i, want, got)
+		}
+		if got := req.Header.Get("X-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+			t.Errorf("Target %d: wrong body hash: %s", i, got)
+		}
+		// Hashing the body leaves it whole
+		body, _ := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if string(body) != "lolcat" {
+			t.Errorf("Target %d: wrong body. Want: lolcat, Got: %s", i, body)
+		}
+	}
+	// Streamed bodies are hashed once
+	if targets[1].payload.sum != hex.EncodeToString(sum[:]) {
+		t.Errorf("Wrong streamed body hash: %q", targets[1].payload.sum)
+	}
+}
+
+func TestCanonicalPath(t *testing.T) {
+	t.Parallel()
+
+	for path, want := range map[string][2]string{
+		"":                   {"/", "/"},
+		"/":                  {"/", "/"},
+		"/a%20b/c%2Fd/e(1)~": {"/a%20b/c%2Fd/e%281%29~", "/a%2520b/c%252Fd/e%25281%2529~"},
+	} {
+		u, err := url.Parse("http://lolcathost:9999" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, twice := range []bool{false, true} {
+			if got := canonicalPath(u, twice); got != want[i] {
+				t.Errorf("Path %q, twice %t: want: %s, got: %s", path, twice, want[i], got)
+			}
+		}
+	}
+}
+
+func TestSignLast(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Authorization"), "x-amz-meta-hook") {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		}),
+	)
+	defer server.Close()
+
+	targets := Targets{{Method: "GET", URL: server.URL}}
+	targets.Sign(&SigV4Signer{AccessKey: "a", SecretKey: "b", Region: "us-east-1", Service: "s3"})
+	atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+	atk.AddRequestHook(RequestHookFunc(func(req *http.Request) {
+		req.Header.Set("X-Amz-Meta-Hook", "lolcat")
+	}))
+	if res := atk.AttackConcy(targets, 1, 1)[0]; res.Code != 200 {
+		t.Errorf("The headers set by hooks should be signed: %+v", res)
+	}
+}
+
+func TestSignSynthetic(t *testing.T) {
+	t.Parallel()
+
+	targets, err := NewTargets([]string{
+		"PUT http://lolcathost:9999/a synth:1KB;repeat=x",
+		"POST http://lolcathost:9999/b form:blob=@synth:1KB",
+	}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = targets.Preload(DefaultBodyCache); err != nil {
+		t.Fatal(err)
+	}
+	targets.Sign(&SigV4Signer{AccessKey: "a", SecretKey: "b", Region: "us-east-1", Service: "s3"})
+
+	sum := sha256.Sum256([]byte(strings.Repeat("x", 1<<10)))
+	for i, want := range []string{hex.EncodeToString(sum[:]), "UNSIGNED-PAYLOAD"} {
+		req, err := targets[i].Request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Body.Close()
+		if got := req.Header.Get("X-Amz-Content-Sha256"); got != want {
+			t.Errorf("Target %d: wrong payload hash. Want: %s, Got: %s", i, want, got)
+		}
+	}
+
+	// Other signatures fail when the body can't be hashed
+	targets.Sign(&HMACSigner{KeyID: "a", Secret: "b"})
+	if _, err = targets[1].Request(); err == nil || !strings.Contains(err.Error(), "can't be hashed") {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
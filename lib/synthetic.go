@@ -0,0 +1,204 @@
+package stress
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Synthetic generates request bodies of random or repeated bytes whose size
+// is fixed, picked in a range or picked out of a weighted distribution,
+// so that uploads of any size need no files. A Synthetic is safe for
+// concurrent use.
+type Synthetic struct {
+	spec   string
+	sizes  []sizeRange
+	total  int64
+	block  []byte
+	repeat bool
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// sizeRange is a range of body sizes picked with the given weight
+type sizeRange struct {
+	min, max, weight int64
+}
+
+// maxSyntheticBlock bounds the block of bytes synthetic bodies are cut out of
+const maxSyntheticBlock = 1 << 20
+
+// NewSynthetic returns a Synthetic described by spec:
+//
+//	SIZES[;seed=N][;repeat=TEXT]
+//
+// SIZES is a comma separated list of sizes like 512, 64KB or 1GB, or of size
+// ranges like 1KB-10MB, picked uniformly. Each one may be given a weight
+// like 1KB*70,1MB-10MB*30. Bodies are made of random bytes unless repeat is
+// set, and are the same from one run to another when seed is set.
+func NewSynthetic(spec string) (*Synthetic, error) {
+	s := &Synthetic{}
+	if err := s.init(spec); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UnmarshalJSON decodes a Synthetic out of its JSON string spec
+func (s *Synthetic) UnmarshalJSON(b []byte) error {
+	var spec string
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return err
+	}
+	return s.init(spec)
+}
+
+// String returns the spec of the Synthetic
+func (s *Synthetic) String() string {
+	return s.spec
+}
+
+func (s *Synthetic) init(spec string) error {
+	opts := strings.Split(spec, ";")
+	s.spec, s.sizes, s.total = spec, nil, 0
+	for _, item := range strings.Split(opts[0], ",") {
+		r := sizeRange{weight: 1}
+		if i := strings.LastIndexByte(item, '*'); i >= 0 {
+			w, err := strconv.ParseInt(item[i+1:], 10, 64)
+			if err != nil || w <= 0 {
+				return fmt.Errorf("Synthetic: weight `%s` is invalid", item[i+1:])
+			}
+			item, r.weight = item[:i], w
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		var err error
+		if r.min, err = parseSize(bounds[0]); err != nil {
+			return err
+		}
+		r.max = r.min
+		if len(bounds) == 2 {
+			if r.max, err = parseSize(bounds[1]); err != nil {
+				return err
+			}
+			if r.max < r.min {
+				return fmt.Errorf("Synthetic: size range `%s` is invalid", item)
+			}
+		}
+		s.sizes = append(s.sizes, r)
+		s.total += r.weight
+	}
+
+	seed := time.Now().UnixNano()
+	var repeat string
+	for _, opt := range opts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case len(kv) == 2 && kv[0] == "seed":
+			n, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("Synthetic: seed `%s` is invalid", kv[1])
+			}
+			seed = n
+		case len(kv) == 2 && kv[0] == "repeat" && kv[1] != "":
+			repeat = kv[1]
+		default:
+			return fmt.Errorf("Synthetic: option `%s` is invalid", opt)
+		}
+	}
+	s.rnd = rand.New(rand.NewSource(seed))
+
+	var max int64 = 1
+	for _, r := range s.sizes {
+		if r.max > max {
+			max = r.max
+		}
+	}
+	if max > maxSyntheticBlock {
+		max = maxSyntheticBlock
+	}
+	if s.repeat = repeat != ""; s.repeat {
+		s.block = bytes.Repeat([]byte(repeat), int(max)/len(repeat)+1)
+	} else {
+		s.block = make([]byte, max)
+		s.rnd.Read(s.block)
+	}
+	return nil
+}
+
+// open returns the body of the next request along with its size
+func (s *Synthetic) open() (io.Reader, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.rnd.Int63n(s.total)
+	r := s.sizes[0]
+	for _, r = range s.sizes {
+		if w < r.weight {
+			break
+		}
+		w -= r.weight
+	}
+	size := r.min
+	if r.max > r.min {
+		size += s.rnd.Int63n(r.max - r.min + 1)
+	}
+
+	// Random bodies start anywhere in the block, repeated ones at the start
+	// of the text
+	off := 0
+	if !s.repeat {
+		off = s.rnd.Intn(len(s.block))
+	}
+	return &syntheticReader{block: s.block, off: off, remain: size}, size
+}
+
+// syntheticReader reads remain bytes out of block, cycling from off
+type syntheticReader struct {
+	block  []byte
+	off    int
+	remain int64
+}
+
+func (r *syntheticReader) Read(p []byte) (int, error) {
+	if r.remain == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remain {
+		p = p[:r.remain]
+	}
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.block[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.block)
+	}
+	r.remain -= int64(n)
+	return n, nil
+}
+
+// parseSize parses a size in bytes like 512, 512B, 64KB, 10MB or 1GB
+func parseSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	shift := uint(0)
+	for _, unit := range []struct {
+		suffix string
+		shift  uint
+	}{{"KB", 10}, {"MB", 20}, {"GB", 30}, {"B", 0}} {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper, shift = strings.TrimSuffix(upper, unit.suffix), unit.shift
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)>>shift {
+		return 0, fmt.Errorf("Synthetic: size `%s` is invalid", s)
+	}
+	return n << shift, nil
+}
@@ -0,0 +1,141 @@
+package stress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+// syntheticBody reads the next body out of s, checking its size
+func syntheticBody(t *testing.T, s *Synthetic) []byte {
+	r, n := s.open()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(body)) != n {
+		t.Fatalf("Wrong synthetic body size. Want: %d, Got: %d", n, len(body))
+	}
+	return body
+}
+
+func TestSyntheticSizes(t *testing.T) {
+	t.Parallel()
+
+	for spec, sizes := range map[string][]int{
+		"0":              {0},
+		"64KB":           {64 << 10},
+		"2mb;seed=1":     {2 << 20},
+		"10-20":          {10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+		"1B*3,2KB-2KB*1": {1, 2 << 10},
+	} {
+		s, err := NewSynthetic(spec)
+		if err != nil {
+			t.Fatalf("`%s` should be valid: %s", spec, err)
+		}
+		seen := map[int]int{}
+		for i := 0; i < 400; i++ {
+			seen[len(syntheticBody(t, s))]++
+		}
+		for size := range seen {
+			found := false
+			for _, want := range sizes {
+				found = found || want == size
+			}
+			if !found {
+				t.Errorf("`%s`: unexpected size %d", spec, size)
+			}
+		}
+		if len(seen) != len(sizes) {
+			t.Errorf("`%s`: want sizes %v, got: %v", spec, sizes, seen)
+		}
+	}
+
+	s, _ := NewSynthetic("1*3,2*1")
+	counts := map[int]int{}
+	for i := 0; i < 4000; i++ {
+		counts[len(syntheticBody(t, s))]++
+	}
+	if counts[1] < 2700 || counts[1] > 3300 {
+		t.Errorf("Sizes weren't picked by weight: %v", counts)
+	}
+}
+
+func TestSyntheticContent(t *testing.T) {
+	t.Parallel()
+
+	a, _ := NewSynthetic("1KB-4KB;seed=42")
+	b, _ := NewSynthetic("1KB-4KB;seed=42")
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(syntheticBody(t, a), syntheticBody(t, b)) {
+			t.Fatal("Seeded synthetic bodies should be the same")
+		}
+	}
+
+	r, _ := NewSynthetic("10;repeat=abc")
+	if body := syntheticBody(t, r); string(body) != "abcabcabca" {
+		t.Errorf("Wrong repeated body: %s", body)
+	}
+
+	big, _ := NewSynthetic("3MB")
+	if body := syntheticBody(t, big); bytes.Count(body, body[:1]) == len(body) {
+		t.Error("Random bodies shouldn't be constant")
+	}
+
+	for _, spec := range []string{"", "lolcat", "1TB", "-1", "2-1", "1*0", "1*x", "1;seed=x", "1;repeat=", "1;lolcat=1"} {
+		if _, err := NewSynthetic(spec); err == nil {
+			t.Errorf("`%s` shouldn't be valid", spec)
+		}
+	}
+}
+
+func TestSyntheticRequest(t *testing.T) {
+	t.Parallel()
+
+	src := []string{
+		"PUT http://lolcathost:9999/a synth:1KB-2KB type:application/octet-stream",
+		"POST http://lolcathost:9999/b form:id=7 form:blob=@synth:100;repeat=x;type=image/png;filename=a.png",
+		`{"method": "POST", "url": "http://lolcathost:9999/c", "form": [{"name": "blob", "synthetic": "5;repeat=y"}]}`,
+	}
+	targets, err := NewTargets(src[:2], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonTargets, err := NewJSONTargets(src[2:], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets = append(targets, jsonTargets...)
+	if err = targets.Preload(DefaultBodyCache); err != nil {
+		t.Fatal(err)
+	}
+
+	if body, ctype := requestBody(t, &targets[0]); len(body) < 1<<10 || len(body) > 2<<10 || ctype != "application/octet-stream" {
+		t.Errorf("Wrong synthetic body of %d bytes, %s", len(body), ctype)
+	}
+
+	for i, want := range [][3]string{{"a.png", "image/png", strings.Repeat("x", 100)}, {"synthetic", "application/octet-stream", "yyyyy"}} {
+		body, ctype := requestBody(t, &targets[i+1])
+		_, params, err := mime.ParseMediaType(ctype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(form.File["blob"]) != 1 {
+			t.Fatalf("Target %d: missing synthetic form file", i+1)
+		}
+		fh := form.File["blob"][0]
+		f, _ := fh.Open()
+		content, _ := ioutil.ReadAll(f)
+		f.Close()
+		if got := [3]string{fh.Filename, fh.Header.Get("Content-Type"), string(content)}; got != want {
+			t.Errorf("Target %d: wrong synthetic form file. Want: %q, Got: %q", i+1, want, got)
+		}
+	}
+}
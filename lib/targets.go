@@ -3,176 +3,412 @@ package stress
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
-	"mime/multipart"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 )
 
-// Target is a HTTP request blueprint
+// Target is a HTTP request blueprint. Its body, of any method, is either
+// Body, BodyFile, a multipart Form or a Synthetic one, with ContentType unless
+// set by Header. A non zero Timeout or Redirects overrides the one of the
+// Attacker, NoRedirects disabling redirects. A Proxy, see ParseProxy,
+// overrides the one of the Attacker too. Bodies are compressed with
+// ContentEncoding, see RegisterCodec, and then sent chunked. Body files are
+// only rendered as templates for every request with TemplateFile.
 type Target struct {
-	Method string
-	URL    string
-	Body   []byte
-	File   string
-	Header http.Header
+	Method          string
+	URL             string
+	Body            []byte
+	BodyFile        string
+	TemplateFile    bool
+	File            string
+	Form            []FormPart
+	Synthetic       *Synthetic
+	ContentType     string
+	ContentEncoding string
+	Header          http.Header
+	Timeout         time.Duration
+	Redirects       int
+	Proxy           string
+	Retry           Retry
+	Expect          Expect
+
+	tmpl    *targetTemplate
+	feeder  *Feeder
+	payload *payload
+	signer  Signer
+	proxy   *targetProxy
+}
+
+// Expect holds the assertions checked against the response to a Target.
+// Empty fields are not checked.
+type Expect struct {
+	Status   []int  `json:"status,omitempty"`
+	MD5      string `json:"md5,omitempty"`
+	Contains string `json:"contains,omitempty"`
+}
+
+// Check returns an error describing the first assertion the response with
+// the passed status code and body doesn't satisfy.
+func (e *Expect) Check(code int, body []byte) error {
+	if len(e.Status) > 0 {
+		ok := false
+		for _, status := range e.Status {
+			ok = ok || status == code
+		}
+		if !ok {
+			return fmt.Errorf("Status %d not expected", code)
+		}
+	}
+	if e.MD5 != "" {
+		sum := md5.Sum(body)
+		if hex.EncodeToString(sum[:]) != strings.ToLower(e.MD5) {
+			return fmt.Errorf("MD5 not matched")
+		}
+	}
+	if e.Contains != "" && !bytes.Contains(body, []byte(e.Contains)) {
+		return fmt.Errorf("Body doesn't contain %q", e.Contains)
+	}
+	return nil
 }
 
 // Request creates an *http.Request out of Target and returns it along with an
 // error in case of failure.
 func (t *Target) Request() (*http.Request, error) {
-	var req *http.Request
+	return t.RequestFor(nil)
+}
+
+// RequestFor creates an *http.Request out of Target on behalf of the passed
+// Session and returns it along with an error in case of failure.
+// Templated parts of the Target are evaluated for every request and the
+// request is signed by the Signer of the Target, if any.
+func (t *Target) RequestFor(s *Session) (*http.Request, error) {
+	data, err := t.next(s)
+	if err != nil {
+		return nil, err
+	}
+	req, err := t.request(data)
+	if err != nil || t.signer == nil {
+		return req, err
+	}
+	if req, err = t.sign(req); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return req, nil
+}
+
+// next returns the template data of the next request built on behalf of s,
+// along with the next row of the Target feeder
+func (t *Target) next(s *Session) (*templateData, error) {
 	var err error
-	if t.Method == "POST" && t.File != "" {
-		if strings.Contains(t.File, "form") {
-			buf := &bytes.Buffer{}
-			w := multipart.NewWriter(buf)
-			kv := strings.Split(t.File, ":")
-			var filekey, filename string
-			if len(kv) == 2 {
-				filekey = "file"
-				filename = kv[1]
-			} else if len(kv) == 3 {
-				filekey = kv[1]
-				filename = kv[2]
-			} else {
-				return nil, fmt.Errorf("Form file: "+"(%s): illegal", t.File)
-			}
-			fw, err := w.CreateFormFile(filekey, filename)
-			if err != nil {
-				//fmt.Println("fail CreateFormFile")
-				return nil, err
-			}
-			fd, err := os.Open(filename)
-			if err != nil {
-				//fmt.Println("fail Open")
-				return nil, err
-			}
-			defer fd.Close()
-			_, err = io.Copy(fw, fd)
-			if err != nil {
-				//fmt.Println("fail Copy")
-				return nil, err
-			}
-			w.Close()
-			req, err = http.NewRequest(t.Method, t.URL, buf)
-			req.Header.Set("Content-Type", w.FormDataContentType())
-		} else {
-			bodyr, err := os.Open(t.File)
-			if err != nil {
-				return nil, fmt.Errorf("Post file: "+"(%s): %s", t.File, err)
-			}
-			defer bodyr.Close()
-			var body []byte
-			if body, err = ioutil.ReadAll(bodyr); err != nil {
-				return nil, fmt.Errorf("Post file: "+"(%s): %s", t.File, err)
-			}
-			req, err = http.NewRequest(t.Method, t.URL, bytes.NewBuffer(body))
-			contentLen := len(body)
-			req.Header.Set("Content-Length", fmt.Sprint(contentLen))
+	data := t.tmpl.data(s)
+	if t.feeder != nil {
+		if data.Data, err = t.feeder.Next(); err != nil {
+			return nil, err
 		}
-	} else {
-		req, err = http.NewRequest(t.Method, t.URL, bytes.NewBuffer(t.Body))
 	}
+	return data, nil
+}
 
+// request creates an *http.Request out of Target, evaluating its templated
+// parts with data. It is left to sign.
+func (t *Target) request(data *templateData) (*http.Request, error) {
+	var err error
+	url := t.URL
+	if t.tmpl != nil {
+		if url, err = renderString(t.tmpl.url, data, url); err != nil {
+			return nil, err
+		}
+	}
+
+	body, size, ctype, err := t.body(data)
 	if err != nil {
 		return nil, err
 	}
+
+	req, err := http.NewRequest(t.Method, url, body)
+	if err != nil {
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	req.ContentLength = size
+	if req.GetBody == nil {
+		req.GetBody = t.rewinder(body, data)
+	}
+	if t.ContentEncoding != "" && req.Body != nil && req.Body != http.NoBody {
+		if err = encodeBody(req, t.ContentEncoding); err != nil {
+			req.Body.Close()
+			return nil, err
+		}
+	}
+	if ctype != "" {
+		req.Header.Set("Content-Type", ctype)
+	}
 	for k, vs := range t.Header {
 		req.Header[k] = make([]string, len(vs))
 		copy(req.Header[k], vs)
 	}
+	if t.tmpl != nil {
+		if err = t.tmpl.renderHeader(req.Header, data); err != nil {
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, err
+		}
+	}
 	req.Header.Set("User-Agent", "stress 1.0")
 	if host := req.Header.Get("Host"); host != "" {
 		req.Host = host
 	}
-
-	// fmt.Printf("--------------t.Header:\n")
-	// for k, vs := range t.Header {
-	// 	for _, vv := range vs {
-	// 		fmt.Printf("%s: %s\n", k, vv)
-	// 	}
-	// }
-	// fmt.Printf("t.Header---------------\n")
+	// The transport ignores a Transfer-Encoding header, the request must
+	// tell it instead
+	if te := req.Header.Get("Transfer-Encoding"); strings.EqualFold(te, "chunked") {
+		req.Header.Del("Transfer-Encoding")
+		req.TransferEncoding = []string{"chunked"}
+		req.ContentLength = -1
+	}
 
 	return req, nil
 }
 
+// sign signs req, built out of the Target, with its Signer. Bodies streamed
+// from disk are hashed once for all the requests instead of being read
+// again for every one.
+func (t *Target) sign(req *http.Request) (*http.Request, error) {
+	if p := t.payload; p != nil && p.hashable() && t.ContentEncoding == "" {
+		sum, err := p.sha256()
+		if err != nil {
+			return req, err
+		}
+		req = req.WithContext(context.WithValue(req.Context(), bodySumKey{}, sum))
+	}
+	return req, t.signer.Sign(req)
+}
+
+// body returns the body of the next request built out of the Target along
+// with its length and its content type when it isn't up to the Target
+// headers. Bodies streamed from disk are returned as an io.ReadCloser.
+func (t *Target) body(data *templateData) (io.Reader, int64, string, error) {
+	if t.Synthetic != nil {
+		r, n := t.Synthetic.open()
+		return r, n, t.ContentType, nil
+	}
+
+	p := t.payload
+	if p == nil && t.payloadKey() != "" {
+		// Attacks prepare the payloads of Targets which weren't preloaded
+		// once, requests built out of them on their own every time
+		budget := int64(math.MaxInt64)
+		var err error
+		if p, err = newPayload(t, &budget); err != nil {
+			return nil, 0, "", err
+		}
+	}
+	if p != nil {
+		r, n, err := p.open(data)
+		if p.ctype != "" {
+			return r, n, p.ctype, err
+		}
+		return r, n, t.ContentType, err
+	}
+
+	body := t.Body
+	if t.tmpl != nil && t.tmpl.body != nil {
+		var err error
+		if body, err = render(t.tmpl.body, data); err != nil {
+			return nil, 0, "", err
+		}
+	}
+	return bytes.NewReader(body), int64(len(body)), t.ContentType, nil
+}
+
+// rewinder returns the GetBody function of a request whose body is built out
+// of the Target, so that it can be read again. It returns nil if the body
+// can't be sent again the same.
+func (t *Target) rewinder(body io.Reader, data *templateData) func() (io.ReadCloser, error) {
+	switch b := body.(type) {
+	case *syntheticReader:
+		start := *b
+		return func() (io.ReadCloser, error) {
+			r := start
+			return ioutil.NopCloser(&r), nil
+		}
+	case readCloser:
+		for _, part := range t.Form {
+			if part.Synthetic != nil {
+				return nil
+			}
+		}
+		return func() (io.ReadCloser, error) {
+			r, _, _, err := t.body(data)
+			if err != nil {
+				return nil, err
+			}
+			if rc, ok := r.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return ioutil.NopCloser(r), nil
+		}
+	}
+	return nil
+}
+
 // Targets is a slice of Targets which can be shuffled
 type Targets []Target
 
+// prepared returns the Targets with what the ones which weren't loaded by
+// the parsers, nor preloaded, need to be attacked prepared once rather than
+// for every request: their payload, within DefaultBodyCache, and their
+// proxy. The Targets are copied when any needs preparing, and left
+// untouched. Requests built out of a payload or sent through a proxy which
+// couldn't be prepared fail with its error.
+func (t Targets) prepared() Targets {
+	var prep Targets
+	cache := map[string]*payload{}
+	budget := DefaultBodyCache
+	for i := range t {
+		key := t[i].payloadKey()
+		needsPayload := key != "" && t[i].payload == nil
+		needsProxy := t[i].Proxy != "" && t[i].proxy == nil
+		if !needsPayload && !needsProxy {
+			continue
+		}
+		if prep == nil {
+			prep = append(Targets(nil), t...)
+		}
+		if needsProxy {
+			prep[i].parseProxy()
+		}
+		if !needsPayload {
+			continue
+		}
+		p, ok := cache[key]
+		if !ok {
+			var err error
+			if p, err = newPayload(&prep[i], &budget); err != nil {
+				p = &payload{err: err}
+			}
+			cache[key] = p
+		}
+		prep[i].payload = p
+	}
+	if prep == nil {
+		return t
+	}
+	return prep
+}
+
+// TemplateFiles renders the body files of all Targets as templates for
+// every request, see Target.TemplateFile. It must be called before Preload.
+func (t Targets) TemplateFiles() {
+	for i := range t {
+		t[i].TemplateFile = true
+	}
+}
+
+// Targets formats
+const (
+	// FormatAuto detects the format out of the first target line
+	FormatAuto = "auto"
+	// FormatText is the format read by NewTargets: METHOD [Header:value ...] URL [File]
+	FormatText = "text"
+	// FormatJSON is the JSON Lines format read by NewJSONTargets
+	FormatJSON = "jsonl"
+)
+
+// maxLineSize is the size of the longest target line which can be read
+const maxLineSize = 16 << 20
+
 // NewTargetsFrom reads targets out of a line separated source skipping empty lines
 // It sets the passed body and http.Header on all targets.
 func NewTargetsFrom(source io.Reader, body []byte, header http.Header) (Targets, error) {
+	return ReadTargets(source, FormatAuto, body, header)
+}
+
+// ReadTargets reads targets in the passed format out of a line separated source.
+// FormatAuto reads JSON Lines if the first target line starts with '{' and
+// the text format otherwise.
+// It sets the passed body and http.Header on all targets.
+func ReadTargets(source io.Reader, format string, body []byte, header http.Header) (Targets, error) {
 	scanner := bufio.NewScanner(source)
+	scanner.Buffer(nil, maxLineSize)
 	var lines []string
 	for scanner.Scan() {
-		line := scanner.Text()
-
-		if line = strings.TrimSpace(line); line != "" && line[0:2] != "//" {
-			// Skipping comments or blank lines
-			lines = append(lines, line)
-		}
+		lines = append(lines, scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	return NewTargets(lines, body, header)
+	if format == FormatAuto {
+		format = FormatText
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" && !isComment(line) {
+				if line[0] == '{' {
+					format = FormatJSON
+				}
+				break
+			}
+		}
+	}
+
+	switch format {
+	case FormatText:
+		return NewTargets(lines, body, header)
+	case FormatJSON:
+		return NewJSONTargets(lines, body, header)
+	default:
+		return nil, fmt.Errorf("Targets format `%s` is invalid", format)
+	}
+}
+
+// isComment reports whether the trimmed line is a comment
+func isComment(line string) bool {
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//")
 }
 
-type headers map[string]string
+// cloneHeader returns a deep copy of header, which may be nil
+func cloneHeader(header http.Header) http.Header {
+	h := make(http.Header, len(header))
+	for k, vs := range header {
+		h[k] = make([]string, len(vs))
+		copy(h[k], vs)
+	}
+	return h
+}
 
-// NewTargets instantiates Targets from a slice of strings.
+// NewTargets instantiates Targets from a slice of lines in the text format
+// described in parser.go, skipping empty lines and comments.
 // It sets the passed body and http.Header on all targets.
 func NewTargets(lines []string, body []byte, header http.Header) (Targets, error) {
-	var targets Targets
-	for _, line := range lines {
-		ps := strings.Split(line, " ")
-		argc := len(ps)
-		if argc >= 2 {
-			newHeader := http.Header{}
-			for k, vs := range header {
-				newHeader[k] = make([]string, len(vs))
-				copy(newHeader[k], vs)
-			}
-			i := 0
-			method := ps[i]
-			i++
-			if strings.Contains(ps[i], "http") == false {
-				for ; i < len(ps) && strings.Contains(ps[i], "http") == false; i++ {
-					kv := strings.Split(ps[i], ":")
-					if len(kv) != 2 {
-						continue
-					} else {
-						newHeader.Set(kv[0], kv[1])
-					}
-				}
-			}
-			var url, postFile string
-			if i < argc {
-				url = ps[i]
-			} else {
-				url = ""
-			}
-			i++
-			if i < argc {
-				postFile = ps[i]
-			} else {
-				postFile = ""
-			}
-			if url != "" {
-				targets = append(targets, Target{Method: method, URL: url, File: postFile, Body: body, Header: newHeader})
-			}
-		} else {
-			return nil, fmt.Errorf("Invalid request format: `%s`", line)
+	p := newTextParser(body, header)
+	for i, line := range lines {
+		if err := p.parseLine(i+1, line); err != nil {
+			return nil, err
 		}
 	}
-	return targets, nil
+	return p.finish()
+}
+
+// Feed attaches the Feeder f to all Targets. Every request built out of
+// them pulls the next row of f.
+func (t Targets) Feed(f *Feeder) {
+	for i := range t {
+		t[i].feeder = f
+	}
 }
 
 // Shuffle randomly alters the order of Targets with the provided seed
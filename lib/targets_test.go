@@ -106,3 +106,26 @@ func TestShuffle(t *testing.T) {
 	}
 	t.Fatal("Targets were not shuffled correctly")
 }
+
+func TestExpectCheck(t *testing.T) {
+	t.Parallel()
+
+	body := []byte("lolcat")
+	for i, tc := range []struct {
+		expect Expect
+		code   int
+		ok     bool
+	}{
+		{Expect{}, 200, true},
+		{Expect{Status: []int{200, 404}}, 404, true},
+		{Expect{Status: []int{200}}, 201, false},
+		{Expect{MD5: "2F07A4C4AE1B1F8E6E0F8A6A1E6A0F2B"}, 200, false},
+		{Expect{MD5: "1AAE4F5EB740067D22088604CD0DC189"}, 200, true},
+		{Expect{Contains: "cat"}, 200, true},
+		{Expect{Contains: "dog"}, 200, false},
+	} {
+		if err := tc.expect.Check(tc.code, body); (err == nil) != tc.ok {
+			t.Errorf("Case %d: want ok: %t, got: %v", i, tc.ok, err)
+		}
+	}
+}
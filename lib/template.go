@@ -0,0 +1,179 @@
+package stress
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// templateFuncs are the functions available in target templates
+var templateFuncs = template.FuncMap{
+	"randInt":     randInt,
+	"randString":  randString,
+	"uuid":        uuid,
+	"timestamp":   func() int64 { return time.Now().Unix() },
+	"timestampMs": func() int64 { return time.Now().UnixNano() / int64(time.Millisecond) },
+	"now":         func(layout string) string { return time.Now().Format(layout) },
+	"env":         os.Getenv,
+}
+
+// templateData is the data a target template is executed with on every
+// request. Seq counts the requests built out of the same Target starting at 1,
+// Worker is the ID of the Session the request is built for and Data is the
+// row handed out by the Feeder of the Target, if any.
+type templateData struct {
+	Worker int
+	Seq    uint64
+	Data   map[string]string
+}
+
+// targetTemplate holds the compiled templates of a Target. Only the parts of
+// the Target which contain template actions are compiled.
+type targetTemplate struct {
+	url    *template.Template
+	header map[string][]*template.Template
+	body   *template.Template
+	seq    uint64
+}
+
+// isTemplate reports whether s contains template actions
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// isTemplateBody reports whether body should be treated as a template.
+// Binary bodies are never templates even if they happen to contain the
+// action delimiters.
+func isTemplateBody(body []byte) bool {
+	return bytes.Contains(body, []byte("{{")) && utf8.Valid(body)
+}
+
+// parseTemplate compiles text into a template named after name
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// compile compiles the templated parts of the Target. Parts without any
+// template action are left untouched and cost nothing per request.
+func (t *Target) compile() error {
+	var err error
+	tt := &targetTemplate{}
+
+	if isTemplate(t.URL) {
+		if tt.url, err = parseTemplate("url", t.URL); err != nil {
+			return err
+		}
+	}
+
+	for k, vs := range t.Header {
+		for i, v := range vs {
+			if !isTemplate(v) {
+				continue
+			}
+			if tt.header == nil {
+				tt.header = map[string][]*template.Template{}
+			}
+			if tt.header[k] == nil {
+				tt.header[k] = make([]*template.Template, len(vs))
+			}
+			if tt.header[k][i], err = parseTemplate(k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if isTemplateBody(t.Body) {
+		if tt.body, err = parseTemplate("body", string(t.Body)); err != nil {
+			return err
+		}
+	}
+
+	t.tmpl = tt
+	return nil
+}
+
+// data returns the templateData of the next request built for s.
+// It is safe to call on a nil targetTemplate, in which case Seq is zero.
+func (tt *targetTemplate) data(s *Session) *templateData {
+	d := &templateData{}
+	if tt != nil {
+		d.Seq = atomic.AddUint64(&tt.seq, 1)
+	}
+	if s != nil {
+		d.Worker = s.ID
+	}
+	return d
+}
+
+// render executes tp with data and returns the output
+func render(tp *template.Template, data interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := tp.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderString executes tp with data if tp isn't nil, returning def otherwise
+func renderString(tp *template.Template, data *templateData, def string) (string, error) {
+	if tp == nil {
+		return def, nil
+	}
+	out, err := render(tp, data)
+	return string(out), err
+}
+
+// renderHeader replaces the templated values of header with their output
+func (tt *targetTemplate) renderHeader(header http.Header, data *templateData) error {
+	for k, tps := range tt.header {
+		for i, tp := range tps {
+			if tp == nil {
+				continue
+			}
+			v, err := render(tp, data)
+			if err != nil {
+				return err
+			}
+			header[k][i] = string(v)
+		}
+	}
+	return nil
+}
+
+// randInt returns a random integer in [min, max]
+func randInt(min, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("randInt: max %d is lower than min %d", max, min)
+	}
+	return min + mrand.Intn(max-min+1), nil
+}
+
+const randChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randString returns a random alphanumeric string of length n
+func randString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randChars[mrand.Intn(len(randChars))]
+	}
+	return string(b)
+}
+
+// uuid returns a random (version 4) UUID
+func uuid() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
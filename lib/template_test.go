@@ -0,0 +1,76 @@
+package stress
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestTemplateRequest(t *testing.T) {
+	t.Parallel()
+
+	os.Setenv("STRESS_TEMPLATE_TEST", "lolcat")
+	lines := []string{`PUT X-Seq:{{.Seq}} http://lolcathost:9999/{{env "STRESS_TEMPLATE_TEST"}}/{{.Worker}}?n={{.Seq}}`}
+	targets, err := NewTargets(lines, []byte(`{"id": "{{uuid}}", "n": {{randInt 1 3}}}`), nil)
+	if err != nil {
+		t.Fatalf("Couldn't parse valid source: %s", err)
+	}
+
+	body := regexp.MustCompile(`^{"id": "[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}", "n": [123]}$`)
+	for i := 1; i <= 3; i++ {
+		req, err := targets[0].RequestFor(&Session{ID: 7})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "http://lolcathost:9999/lolcat/7?n=" + strconv.Itoa(i)
+		if got := req.URL.String(); got != want {
+			t.Errorf("Wrong URL. Want: %s, Got: %s", want, got)
+		}
+		if want, got := strconv.Itoa(i), req.Header.Get("X-Seq"); want != got {
+			t.Errorf("Wrong header. Want: %s, Got: %s", want, got)
+		}
+		got, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !body.Match(got) {
+			t.Errorf("Wrong body. Got: %s", got)
+		}
+	}
+
+	if targets[0].Header.Get("X-Seq") != "{{.Seq}}" {
+		t.Error("Rendering must not alter the Target header")
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range []string{
+		"GET http://lolcathost:9999/{{",
+		"GET http://lolcathost:9999/{{nope}}",
+	} {
+		if _, err := NewTargets([]string{line}, nil, nil); err == nil {
+			t.Errorf("Template `%s` shouldn't be valid", line)
+		}
+	}
+
+	targets, err := NewTargets([]string{"GET http://lolcathost:9999/{{randInt 3 1}}"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := targets[0].Request(); err == nil {
+		t.Error("randInt with max lower than min should fail")
+	}
+}
+
+func TestRandString(t *testing.T) {
+	t.Parallel()
+
+	if s := randString(16); !regexp.MustCompile(`^[a-zA-Z0-9]{16}$`).MatchString(s) {
+		t.Errorf("Wrong random string: %s", s)
+	}
+}
@@ -0,0 +1,165 @@
+package stress
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Threshold is a service level objective checked against the Metrics of
+// an attack, like p99<250ms or success>=99.9%
+type Threshold struct {
+	// Metric is one of mean, p50, p95, p99 and max latencies, success,
+	// qps, requests, or status:CODE or status:CLASS like status:5xx
+	Metric string
+	// Op is one of <, <=, >, >= and ==
+	Op string
+	// Value is a duration in nanoseconds for latencies, a ratio for
+	// success and status counts given in percents, a count otherwise
+	Value float64
+
+	spec  string
+	ratio bool
+}
+
+// Thresholds is a list of Threshold which all must pass
+type Thresholds []Threshold
+
+// ThresholdResult tells whether a Threshold passed along with the actual
+// value of its metric
+type ThresholdResult struct {
+	Threshold string `json:"threshold"`
+	Actual    string `json:"actual"`
+	Pass      bool   `json:"pass"`
+}
+
+var thresholdRe = regexp.MustCompile(`^\s*([a-z0-9]+(?::[0-9x]+)?)\s*(<=|>=|==|<|>)\s*(\S+)\s*$`)
+
+// ParseThresholds parses a comma separated list of thresholds like
+// p99<250ms,success>=99.9%,qps>=800,status:5xx<1%
+func ParseThresholds(spec string) (Thresholds, error) {
+	var th Thresholds
+	for _, s := range strings.Split(spec, ",") {
+		t, err := parseThreshold(s)
+		if err != nil {
+			return nil, err
+		}
+		th = append(th, t)
+	}
+	return th, nil
+}
+
+func parseThreshold(s string) (Threshold, error) {
+	m := thresholdRe.FindStringSubmatch(s)
+	if m == nil {
+		return Threshold{}, fmt.Errorf("threshold `%s` is invalid", s)
+	}
+	t := Threshold{Metric: m[1], Op: m[2], spec: strings.TrimSpace(s)}
+	value := m[3]
+
+	var err error
+	switch metric := t.Metric; {
+	case metric == "mean" || metric == "p50" || metric == "p95" || metric == "p99" || metric == "max":
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		t.Value = float64(d)
+	case metric == "success":
+		t.Value, err = parseRatio(value)
+		t.ratio = true
+	case metric == "qps" || metric == "requests":
+		t.Value, err = strconv.ParseFloat(value, 64)
+	case strings.HasPrefix(metric, "status:"):
+		if t.ratio = strings.HasSuffix(value, "%"); t.ratio {
+			t.Value, err = parseRatio(value)
+		} else {
+			t.Value, err = strconv.ParseFloat(value, 64)
+		}
+	default:
+		return Threshold{}, fmt.Errorf("threshold `%s` has an unknown metric", s)
+	}
+	if err != nil {
+		return Threshold{}, fmt.Errorf("threshold `%s` has an invalid value", s)
+	}
+	return t, nil
+}
+
+// String returns the threshold as it was parsed
+func (t Threshold) String() string {
+	if t.spec != "" {
+		return t.spec
+	}
+	return fmt.Sprintf("%s%s%g", t.Metric, t.Op, t.Value)
+}
+
+// Check checks the Threshold against m
+func (t Threshold) Check(m *Metrics) ThresholdResult {
+	var actual float64
+	var format func(float64) string
+	ratio := func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) }
+	duration := func(v float64) string { return time.Duration(v).String() }
+
+	switch t.Metric {
+	case "mean":
+		actual, format = float64(m.Latencies.Mean), duration
+	case "p50":
+		actual, format = float64(m.Latencies.P50), duration
+	case "p95":
+		actual, format = float64(m.Latencies.P95), duration
+	case "p99":
+		actual, format = float64(m.Latencies.P99), duration
+	case "max":
+		actual, format = float64(m.Latencies.Max), duration
+	case "success":
+		actual, format = m.Success, ratio
+	case "qps":
+		actual, format = m.QPS, func(v float64) string { return fmt.Sprintf("%.2f", v) }
+	case "requests":
+		actual = float64(m.Requests)
+	default:
+		status := strings.TrimPrefix(t.Metric, "status:")
+		for code, count := range m.StatusCodes {
+			if code == status || (strings.HasSuffix(status, "xx") && len(code) == 3 && code[0] == status[0]) {
+				actual += float64(count)
+			}
+		}
+		if t.ratio {
+			if m.Requests > 0 {
+				actual /= float64(m.Requests)
+			}
+			format = ratio
+		}
+	}
+	if format == nil {
+		format = func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	}
+
+	var pass bool
+	switch t.Op {
+	case "<":
+		pass = actual < t.Value
+	case "<=":
+		pass = actual <= t.Value
+	case ">":
+		pass = actual > t.Value
+	case ">=":
+		pass = actual >= t.Value
+	case "==":
+		pass = actual == t.Value
+	}
+	return ThresholdResult{Threshold: t.String(), Actual: format(actual), Pass: pass}
+}
+
+// Check checks all Thresholds against m, setting m.Thresholds, and reports
+// whether they all passed
+func (th Thresholds) Check(m *Metrics) bool {
+	pass := true
+	m.Thresholds = make([]ThresholdResult, 0, len(th))
+	for _, t := range th {
+		res := t.Check(m)
+		pass = pass && res.Pass
+		m.Thresholds = append(m.Thresholds, res)
+	}
+	return pass
+}
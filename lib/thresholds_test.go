@@ -0,0 +1,106 @@
+package stress
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseThresholds(t *testing.T) {
+	t.Parallel()
+
+	th, err := ParseThresholds("p99<250ms, success>=99.9%,qps>=800,status:5xx<1%,status:429<=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		metric, op string
+		value      float64
+	}{
+		{"p99", "<", float64(250 * time.Millisecond)},
+		{"success", ">=", 0.999},
+		{"qps", ">=", 800},
+		{"status:5xx", "<", 0.01},
+		{"status:429", "<=", 10},
+	}
+	if len(th) != len(want) {
+		t.Fatalf("Want %d thresholds, Got: %+v", len(want), th)
+	}
+	for i, w := range want {
+		if th[i].Metric != w.metric || th[i].Op != w.op || math.Abs(th[i].Value-w.value) > 1e-9 {
+			t.Errorf("Threshold %d: want: %+v, got: %+v", i, w, th[i])
+		}
+	}
+
+	for _, spec := range []string{"", "p99", "p99<fast", "success>=200%", "lolcat>1", "p99=1s"} {
+		if _, err := ParseThresholds(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestThresholdsCheck(t *testing.T) {
+	t.Parallel()
+
+	results := make([]Result, 0, 100)
+	for i := 0; i < 100; i++ {
+		res := Result{Code: 200, Timestamp: time.Unix(int64(i), 0), Latency: 100 * time.Millisecond}
+		if i%20 == 0 {
+			res.Code = 503
+		}
+		results = append(results, res)
+	}
+	m := NewMetrics(results)
+
+	th, _ := ParseThresholds("max<=100ms,success>=99%,status:5xx<10%,status:503==5,requests>100")
+	if th.Check(m) {
+		t.Error("Expected thresholds to fail")
+	}
+	want := []ThresholdResult{
+		{"max<=100ms", "100ms", true},
+		{"success>=99%", "95.00%", false},
+		{"status:5xx<10%", "5.00%", true},
+		{"status:503==5", "5", true},
+		{"requests>100", "100", false},
+	}
+	if !reflect.DeepEqual(m.Thresholds, want) {
+		t.Errorf("Want: %+v\nGot: %+v", want, m.Thresholds)
+	}
+}
+
+func TestThresholdsReporters(t *testing.T) {
+	t.Parallel()
+
+	results := []Result{
+		{Code: 200, Timestamp: time.Unix(0, 0), Latency: time.Second},
+		{Code: 200, Timestamp: time.Unix(1, 0), Latency: time.Second},
+	}
+	th, _ := ParseThresholds("p99<250ms,success>=99%")
+
+	text, _ := TextReporter(th)(results)
+	for _, line := range []string{"FAIL  p99<250ms", "PASS  success>=99%"} {
+		if !strings.Contains(strings.Join(strings.Fields(string(text)), "  "), line) {
+			t.Errorf("Missing `%s` in the text report:\n%s", line, text)
+		}
+	}
+
+	data, _ := JSONReporter(th)(results)
+	var m Metrics
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Thresholds) != 2 || m.Thresholds[0].Pass || !m.Thresholds[1].Pass {
+		t.Errorf("Wrong JSON thresholds: %+v", m.Thresholds)
+	}
+
+	plot, _ := PlotReporter(th)(results)
+	if !strings.Contains(string(plot), "<li>FAIL p99&lt;250ms (1s)</li>") {
+		t.Error("Missing thresholds in the plot report")
+	}
+	if plot, _ = ReportPlot(results); strings.Contains(string(plot), "thresholds") {
+		t.Error("Unexpected thresholds in the plot report")
+	}
+}
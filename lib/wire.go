@@ -0,0 +1,90 @@
+package stress
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// wireConn counts the bytes read and written on a connection dialed by an
+// Attacker, TLS records and proxy handshakes included, on behalf of the
+// request it currently carries. Bytes exchanged before the first request
+// gets the connection, like the ones of the handshakes, go to that request.
+// Connections which never carry a request, dialed for requests which got
+// another one first, are not counted.
+type wireConn struct {
+	net.Conn
+	conns *sync.Map
+
+	mu       sync.Mutex
+	owner    *phases
+	in, out  int64
+	released bool
+}
+
+// dial dials a connection going through the emulated Network of the
+// Attacker, whose bytes are counted, see wireConn
+func (a *Attacker) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := a.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &wireConn{Conn: newShapedConn(conn, a.network), conns: &a.conns}
+	a.conns.Store(conn.LocalAddr().String(), c)
+	return c, nil
+}
+
+func (c *wireConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.count(int64(n), 0)
+	return n, err
+}
+
+func (c *wireConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.count(0, int64(n))
+	return n, err
+}
+
+func (c *wireConn) Close() error {
+	c.mu.Lock()
+	if !c.released {
+		c.released = true
+		c.conns.Delete(c.LocalAddr().String())
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *wireConn) count(in, out int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.owner == nil {
+		c.in, c.out = c.in+in, c.out+out
+		return
+	}
+	atomic.AddInt64(&c.owner.wireIn, in)
+	atomic.AddInt64(&c.owner.wireOut, out)
+}
+
+// carry makes the connection count its bytes on behalf of the request
+// traced by p from now on
+func (c *wireConn) carry(p *phases) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.owner = p
+	atomic.AddInt64(&p.wireIn, c.in)
+	atomic.AddInt64(&p.wireOut, c.out)
+	c.in, c.out = 0, 0
+}
+
+// wireConnOf returns the wireConn under conn, which may be wrapped by TLS or
+// SOCKS5, out of their local address
+func wireConnOf(conns *sync.Map, conn net.Conn) (*wireConn, bool) {
+	c, ok := conns.Load(conn.LocalAddr().String())
+	if !ok {
+		return nil, false
+	}
+	return c.(*wireConn), true
+}
@@ -0,0 +1,84 @@
+package stress
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingListener counts the bytes read and written on its connections
+type countingListener struct {
+	net.Listener
+	in, out int64
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countedConn{Conn: conn, l: l}, nil
+}
+
+type countedConn struct {
+	net.Conn
+	l *countingListener
+}
+
+func (c *countedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(&c.l.in, int64(n))
+	return n, err
+}
+
+func (c *countedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	atomic.AddInt64(&c.l.out, int64(n))
+	return n, err
+}
+
+func TestWireBytes(t *testing.T) {
+	t.Parallel()
+
+	for _, tls := range []bool{false, true} {
+		server := httptest.NewUnstartedServer(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strings.Repeat("lolcat", 100)))
+			}),
+		)
+		l := &countingListener{Listener: server.Listener}
+		server.Listener = l
+		if tls {
+			server.StartTLS()
+		} else {
+			server.Start()
+		}
+
+		atk := NewAttacker(DefaultRedirects, DefaultTimeout, DefaultLocalAddr)
+		tgts := Targets{
+			{Method: "GET", URL: server.URL},
+			{Method: "PUT", URL: server.URL, Body: []byte("lolcat"), Header: http.Header{"Transfer-Encoding": {"chunked"}}},
+		}
+		// A single worker, since connections dialed for requests which got
+		// another one before are left out
+		results := atk.AttackConcy(tgts, 1, 20)
+
+		var in, out uint64
+		for _, res := range results {
+			if res.Code != 200 || res.WireIn <= res.BytesIn || res.WireOut <= res.BytesOut {
+				t.Fatalf("TLS %t: wrong result: %+v", tls, res)
+			}
+			in, out = in+res.WireIn, out+res.WireOut
+		}
+		if want := uint64(atomic.LoadInt64(&l.out)); in != want {
+			t.Errorf("TLS %t: wrong wire in. Want: %d, Got: %d", tls, want, in)
+		}
+		if want := uint64(atomic.LoadInt64(&l.in)); out != want {
+			t.Errorf("TLS %t: wrong wire out. Want: %d, Got: %d", tls, want, out)
+		}
+		server.Close()
+	}
+}
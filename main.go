@@ -35,15 +35,37 @@ func main() {
 	if cmd, ok := commands[args[0]]; !ok {
 		log.Fatalf("Unknown command: %s", args[0])
 	} else if err := cmd.fn(args[1:]); err != nil {
+		if e, ok := err.(*exitError); ok {
+			log.Println(e.msg)
+			os.Exit(e.code)
+		}
 		log.Fatal(err)
 	}
 }
 
+// Exit codes telling why a command failed apart from errors, which exit
+// with 1
+const (
+	// exitStopped tells that the attack was stopped early by -stop-on or
+	// from the dashboard
+	exitStopped = 3
+	// exitThresholds tells that the report violated -thresholds
+	exitThresholds = 4
+)
+
+// exitError ends the program with its code once the command is done
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string { return e.msg }
+
 const examples = `
 examples:
-  echo "GET HOST:ww2.sinaimg.cn resize-type:crop.100.100.200.200.100 http://127.0.0.1:8088/bmiddle/50caec1agw1ef9myz5zhoj21ck0yggv6.jpg" | stress attack -duration=5s -rate=100 | tee results.bin | stress report
-  echo "POST http://127.0.0.1:12345/ form:filename:5f189.jpeg" | stress attack -duration=5s -rate=1 | tee results.bin | stress report
-  stress attack -targets=targets.txt > results.bin
+  echo "GET HOST:ww2.sinaimg.cn resize-type:crop.100.100.200.200.100 http://127.0.0.1:8088/bmiddle/50caec1agw1ef9myz5zhoj21ck0yggv6.jpg" | stress attack -duration=5s -rate=100 -output=stdout | tee results.bin | stress report
+  echo "POST http://127.0.0.1:12345/ form:filename:5f189.jpeg" | stress attack -duration=5s -rate=1 -output=stdout | tee results.bin | stress report
+  stress attack -targets=targets.txt -output=stdout -summary=false > results.bin
   stress report -input=results.bin -reporter=json > metrics.json
   cat results.bin | stress report -reporter=plot > plot.html
 `
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"strings"
 
@@ -15,6 +16,7 @@ func reportCmd() command {
 	fs.StringVar(&opts.reporter, "reporter", "text", "Reporter [text, json, plot]")
 	fs.StringVar(&opts.inputf, "input", "stdin", "Input files (comma separated)")
 	fs.StringVar(&opts.outputf, "output", "stdout", "Output file")
+	fs.StringVar(&opts.thresholds, "thresholds", "", "Thresholds to pass (comma separated), e.g. p99<250ms,success>=99.9%")
 
 	return command{fs, func(args []string) error {
 		fs.Parse(args)
@@ -24,19 +26,29 @@ func reportCmd() command {
 
 // reportOpts aggregates the report function command options
 type reportOpts struct {
-	reporter string
-	inputf   string
-	outputf  string
+	reporter   string
+	inputf     string
+	outputf    string
+	thresholds string
 }
 
 // report validates the report arguments, sets up the required resources
 // and writes the report
 func report(opts *reportOpts) error {
-	rep, ok := reporters[opts.reporter]
+	var th stress.Thresholds
+	if opts.thresholds != "" {
+		var err error
+		if th, err = stress.ParseThresholds(opts.thresholds); err != nil {
+			return fmt.Errorf(errThresholdsPrefix+"%s", err)
+		}
+	}
+
+	newReporter, ok := reporters[opts.reporter]
 	if !ok {
 		log.Println("Reporter provided is not supported. Using text")
-		rep = stress.ReportText
+		newReporter = stress.TextReporter
 	}
+	rep := newReporter(th)
 
 	var all stress.Results
 	for _, input := range strings.Split(opts.inputf, ",") {
@@ -65,13 +77,27 @@ func report(opts *reportOpts) error {
 	if err != nil {
 		return err
 	}
-	_, err = out.Write(data)
+	if _, err = out.Write(data); err != nil {
+		return err
+	}
 
-	return err
+	m := stress.NewMetrics(all)
+	if len(th) > 0 && !th.Check(m) {
+		var failed []string
+		for _, t := range m.Thresholds {
+			if !t.Pass {
+				failed = append(failed, fmt.Sprintf("%s (%s)", t.Threshold, t.Actual))
+			}
+		}
+		return &exitError{exitThresholds, "Thresholds violated: " + strings.Join(failed, ", ")}
+	}
+	return nil
 }
 
-var reporters = map[string]stress.Reporter{
-	"text": stress.ReportText,
-	"json": stress.ReportJSON,
-	"plot": stress.ReportPlot,
+const errThresholdsPrefix = "Thresholds: "
+
+var reporters = map[string]func(stress.Thresholds) stress.Reporter{
+	"text": stress.TextReporter,
+	"json": stress.JSONReporter,
+	"plot": stress.PlotReporter,
 }